@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/n-r-w/protodep/internal/config"
+)
+
+var addCmd = &cobra.Command{
+	Use:   "add target@rev",
+	Short: "Add a dependency to protodep.toml",
+	Long: `Add a dependency to protodep.toml after checking that the target is reachable and the revision exists.
+rev is a branch, tag, commit or version constraint. Without @rev the default branch is used.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dep, err := config.ParseDependencySpec(args[0])
+		if err != nil {
+			return err
+		}
+
+		if dep.Name, err = cmd.Flags().GetString("name"); err != nil {
+			return err
+		}
+		if dep.Path, err = cmd.Flags().GetString("path"); err != nil {
+			return err
+		}
+		if dep.Includes, err = cmd.Flags().GetStringArray("include"); err != nil {
+			return err
+		}
+		if dep.Ignores, err = cmd.Flags().GetStringArray("ignore"); err != nil {
+			return err
+		}
+		if dep.Protocol, err = cmd.Flags().GetString("protocol"); err != nil {
+			return err
+		}
+
+		conf, err := resolverConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		addService, err := newResolver(conf)
+		if err != nil {
+			return err
+		}
+
+		return addService.Add(cmd.Context(), dep)
+	},
+}
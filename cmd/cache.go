@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/n-r-w/protodep/internal/cache"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cache of dependency repositories",
+}
+
+var cachePathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the cache directory",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		dir, err := cacheDir(cmd)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(dir)
+		return nil
+	},
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the cached repositories with their size, last fetch time and the configs using them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		dir, err := cacheDir(cmd)
+		if err != nil {
+			return err
+		}
+
+		entries, err := cache.List(dir)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+		fmt.Fprintln(w, "REPOSITORY\tSIZE\tLAST FETCH\tCONFIGS")
+		var total int64
+		for _, e := range entries {
+			lastFetch := "-"
+			if !e.LastFetch.IsZero() {
+				lastFetch = e.LastFetch.Local().Format("2006-01-02 15:04")
+			}
+			configs := "-"
+			if len(e.Configs) > 0 {
+				configs = strings.Join(e.Configs, ", ")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Repository, cache.FormatSize(e.Size), lastFetch, configs)
+			total += e.Size
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Printf("\n%d repositories, %s in %s\n", len(entries), cache.FormatSize(total), dir)
+		return nil
+	},
+}
+
+var cacheRemoveCmd = &cobra.Command{
+	Use:   "remove <repository>...",
+	Short: "Remove cached repositories, given as listed by cache list",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := cacheDir(cmd)
+		if err != nil {
+			return err
+		}
+
+		lockTimeout, err := cmd.Flags().GetDuration("lock-timeout")
+		if err != nil {
+			return err
+		}
+
+		for _, repository := range args {
+			if err := cache.Remove(cmd.Context(), dir, repository, lockTimeout); err != nil {
+				return err
+			}
+			logger.Info("removed %s", repository)
+		}
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached repositories not used recently or beyond a total size",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		olderThanFlag, err := cmd.Flags().GetString("older-than")
+		if err != nil {
+			return err
+		}
+
+		maxSizeFlag, err := cmd.Flags().GetString("max-size")
+		if err != nil {
+			return err
+		}
+
+		if olderThanFlag == "" && maxSizeFlag == "" {
+			return errors.New("--older-than or --max-size is required")
+		}
+
+		var olderThan time.Duration
+		if olderThanFlag != "" {
+			if olderThan, err = cache.ParseAge(olderThanFlag); err != nil {
+				return err
+			}
+		}
+
+		var maxSize int64
+		if maxSizeFlag != "" {
+			if maxSize, err = cache.ParseSize(maxSizeFlag); err != nil {
+				return err
+			}
+		}
+
+		lockTimeout, err := cmd.Flags().GetDuration("lock-timeout")
+		if err != nil {
+			return err
+		}
+
+		dir, err := cacheDir(cmd)
+		if err != nil {
+			return err
+		}
+
+		removed, err := cache.Prune(cmd.Context(), dir, olderThan, maxSize, lockTimeout)
+		for _, e := range removed {
+			logger.Info("removed %s (%s)", e.Repository, cache.FormatSize(e.Size))
+		}
+		if err != nil {
+			return err
+		}
+
+		logger.Info("pruned %d repositories", len(removed))
+		return nil
+	},
+}
+
+// cacheDir returns the directory of the cached repositories, given by the flag registered by addCacheFlags.
+func cacheDir(cmd *cobra.Command) (string, error) {
+	dir, err := cmd.Flags().GetString("cache-dir")
+	if err != nil {
+		return "", err
+	}
+
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return cache.Dir(dir, homeDir)
+}
+
+// addCacheFlags registers the flags of the commands using the cache.
+func addCacheFlags(flags *pflag.FlagSet) {
+	flags.String("cache-dir", "", "directory of the cached repositories (default $"+cache.EnvDir+" or $XDG_CACHE_HOME/protodep)")
+	flags.Duration("lock-timeout", cache.DefaultLockTimeout, "how long to wait for other protodep processes using a cached repository")
+}
+
+func initCacheCmd() {
+	cachePruneCmd.Flags().String("older-than", "", "remove repositories not used for this long, e.g. 30d or 12h")
+	cachePruneCmd.Flags().String("max-size", "", "remove the least recently used repositories until the cache fits, e.g. 5GB")
+
+	addCacheFlags(cacheCmd.PersistentFlags())
+
+	cacheCmd.AddCommand(cacheListCmd, cacheRemoveCmd, cachePruneCmd, cachePathCmd)
+}
@@ -1,6 +1,8 @@
 package cmd
 
 func init() {
-	RootCmd.AddCommand(upCmd, versionCmd)
+	RootCmd.AddCommand(initCmd, upCmd, updateCmd, addCmd, removeCmd, verifyCmd, outdatedCmd, cacheCmd, versionCmd)
 	initDepCmd()
+	initInitCmd()
+	initCacheCmd()
 }
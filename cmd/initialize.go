@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// fallbackProtoOutdir is used when the project keeps its own proto files in config.DefaultProtoOutdir.
+const fallbackProtoOutdir = "./third_party/proto"
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create protodep.toml in the current directory",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		protoOutdir, err := cmd.Flags().GetString("proto-outdir")
+		if err != nil {
+			return err
+		}
+
+		specs, err := cmd.Flags().GetStringArray("dep")
+		if err != nil {
+			return err
+		}
+
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		pwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		deps := make([]config.ProtoDepDependency, 0, len(specs))
+		for _, spec := range specs {
+			dep, err := config.ParseDependencySpec(spec)
+			if err != nil {
+				return err
+			}
+			deps = append(deps, dep)
+		}
+
+		dep := config.NewDependency(pwd)
+
+		protoDirs, err := config.FindProtoDirs(pwd)
+		if err != nil {
+			return err
+		}
+		if existing, err := dep.Load(); err == nil {
+			// Files vendored by the current protodep.toml are not proto files of the project.
+			protoDirs = slices.DeleteFunc(protoDirs, func(dir string) bool {
+				return config.CheckProtoOutdir(existing.ProtoOutdir, []string{dir}) != nil
+			})
+		}
+		for _, dir := range protoDirs {
+			logger.Info("found proto files in %s", dir)
+		}
+
+		if protoOutdir == "" {
+			protoOutdir = config.DefaultProtoOutdir
+			if config.CheckProtoOutdir(protoOutdir, protoDirs) != nil {
+				protoOutdir = fallbackProtoOutdir
+			}
+		}
+		if err := config.CheckProtoOutdir(protoOutdir, protoDirs); err != nil {
+			return err
+		}
+
+		if err := dep.Create(config.Scaffold(protoOutdir, deps, protoDirs), force); err != nil {
+			if errors.Is(err, os.ErrExist) {
+				return fmt.Errorf("%w, use --force to overwrite it", err)
+			}
+			return err
+		}
+
+		logger.Info("created %s with proto_outdir %s", config.FileName, protoOutdir)
+
+		return nil
+	},
+}
+
+func initInitCmd() {
+	initCmd.Flags().String("proto-outdir", "", "output directory for vendored proto files (default \"./proto\", or \"./third_party/proto\" if ./proto holds proto files of the project)")
+	initCmd.Flags().StringArray("dep", nil, "add a dependency given as target@rev, rev is a branch, tag, commit or version constraint (repeatable)")
+	initCmd.Flags().BoolP("force", "f", false, "overwrite an existing protodep.toml")
+}
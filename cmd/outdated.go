@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/n-r-w/protodep/internal/logger"
+	"github.com/n-r-w/protodep/internal/resolver"
+)
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "List dependencies with newer upstream commits or versions",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			// Keep stdout parseable.
+			logger.UseStderr()
+		}
+
+		conf, err := resolverConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		outdatedService, err := newResolver(conf)
+		if err != nil {
+			return err
+		}
+
+		deps, err := outdatedService.Outdated(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(deps)
+		}
+
+		return printOutdated(deps)
+	},
+}
+
+func printOutdated(deps []resolver.OutdatedDependency) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(w, "DEPENDENCY\tKIND\tREQUIREMENT\tCURRENT\tWANTED\tLATEST\tOUTDATED")
+	for _, d := range deps {
+		current, wanted, latest := d.Current, d.Wanted, d.Latest
+		if d.Kind == resolver.OutdatedKindBranch {
+			current, wanted, latest = shortHash(current), shortHash(wanted), shortHash(latest)
+		}
+		name := d.Name
+		if name == "" {
+			name = d.Target
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
+			name, d.Kind, d.Requirement, orDash(current), orDash(wanted), orDash(latest), d.Outdated)
+	}
+	return w.Flush()
+}
+
+func shortHash(hash string) string {
+	const shortHashLen = 12
+	if len(hash) > shortHashLen {
+		return hash[:shortHashLen]
+	}
+	return hash
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/n-r-w/protodep/internal/resolver"
+)
+
+var removeCmd = &cobra.Command{
+	Use:   "remove <name|target|local_folder>",
+	Short: "Remove a dependency from protodep.toml together with its lock entry and vendored files",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		pwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		removeService, err := resolver.New(&resolver.Config{TargetDir: pwd, OutputDir: pwd}, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		return removeService.Remove(args[0])
+	},
+}
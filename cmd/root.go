@@ -15,7 +15,10 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -28,8 +31,13 @@ var RootCmd = &cobra.Command{
 }
 
 // Execute executes the root command.
+// The context passed to the commands is canceled on interrupt, so they can stop without leaving a half-written state.
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := RootCmd.ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
 		color.Red(err.Error())
 		os.Exit(-1)
 	}
@@ -1,16 +1,23 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/n-r-w/protodep/internal/logger"
 	"github.com/n-r-w/protodep/internal/resolver"
 )
 
+// offlineEnv enables offline mode like the --offline flag.
+const offlineEnv = "PROTODEP_OFFLINE"
+
 var upCmd = &cobra.Command{
 	Use:   "up",
 	Short: "Populate .proto vendors existing protodep.toml",
@@ -21,103 +28,211 @@ var upCmd = &cobra.Command{
 		}
 		logger.Info("cleanup cache = %t", isCleanupCache)
 
-		identityFile, err := cmd.Flags().GetString("identity-file")
+		frozen, err := cmd.Flags().GetBool("frozen")
 		if err != nil {
 			return err
 		}
-		logger.Info("identity file = %s", identityFile)
+		logger.Info("frozen = %t", frozen)
 
-		password, err := cmd.Flags().GetString("password")
+		update, err := cmd.Flags().GetBool("update")
 		if err != nil {
 			return err
 		}
-		if password != "" {
-			logger.Info("password = %s", strings.Repeat("x", len(password))) // Do not display the password.
-		}
+		logger.Info("update = %t", update)
 
-		useHTTPS, err := cmd.Flags().GetBool("use-https")
-		if err != nil {
-			return err
+		if frozen && (update || isCleanupCache) {
+			return errors.New("--frozen cannot be used together with --update or --cleanup")
 		}
-		logger.Info("use https = %t", useHTTPS)
 
-		useNetrc, err := cmd.Flags().GetBool("use-netrc")
+		conf, err := resolverConfig(cmd)
 		if err != nil {
 			return err
 		}
-		logger.Info("use netrc = %t", useNetrc)
+		conf.Update = update
 
-		useGitCredentials, err := cmd.Flags().GetBool("use-git-credentials")
+		updateService, err := newResolver(conf)
 		if err != nil {
 			return err
 		}
-		logger.Info("use git credentials = %t", useGitCredentials)
 
-		basicAuthUsername, err := cmd.Flags().GetString("basic-auth-username")
-		if err != nil {
-			return err
-		}
-		if basicAuthUsername != "" {
-			logger.Info("https basic auth username = %s", basicAuthUsername)
+		if frozen {
+			return updateService.Verify(cmd.Context())
 		}
 
-		basicAuthPassword, err := cmd.Flags().GetString("basic-auth-password")
-		if err != nil {
-			return err
-		}
-		if basicAuthPassword != "" {
-			logger.Info("https basic auth password = %s", strings.Repeat("x", len(basicAuthPassword))) // Do not display the password.
-		}
-
-		pwd, err := os.Getwd()
-		if err != nil {
-			return err
-		}
-
-		homeDir, err := homedir.Dir()
-		if err != nil {
-			return err
-		}
+		return updateService.Resolve(cmd.Context(), isCleanupCache)
+	},
+}
 
-		conf := resolver.Config{
-			UseHttps:                useHTTPS,
-			UseGitCredentialsHelper: useGitCredentials,
-			UseNetrc:                useNetrc,
-			HomeDir:                 homeDir,
-			TargetDir:               pwd,
-			OutputDir:               pwd,
-			BasicAuthUsername:       basicAuthUsername,
-			BasicAuthPassword:       basicAuthPassword,
-			IdentityFile:            identityFile,
-			IdentityPassword:        password,
-		}
+// resolverConfig reads the flags registered by addResolverFlags.
+func resolverConfig(cmd *cobra.Command) (*resolver.Config, error) {
+	identityFile, err := cmd.Flags().GetString("identity-file")
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("identity file = %s", identityFile)
+
+	password, err := cmd.Flags().GetString("password")
+	if err != nil {
+		return nil, err
+	}
+	if password != "" {
+		logger.Info("password = %s", strings.Repeat("x", len(password))) // Do not display the password.
+	}
+
+	useHTTPS, err := cmd.Flags().GetBool("use-https")
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("use https = %t", useHTTPS)
+
+	useNetrc, err := cmd.Flags().GetBool("use-netrc")
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("use netrc = %t", useNetrc)
+
+	useGitCredentials, err := cmd.Flags().GetBool("use-git-credentials")
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("use git credentials = %t", useGitCredentials)
+
+	basicAuthUsername, err := cmd.Flags().GetString("basic-auth-username")
+	if err != nil {
+		return nil, err
+	}
+	if basicAuthUsername != "" {
+		logger.Info("https basic auth username = %s", basicAuthUsername)
+	}
+
+	basicAuthPassword, err := cmd.Flags().GetString("basic-auth-password")
+	if err != nil {
+		return nil, err
+	}
+	if basicAuthPassword != "" {
+		logger.Info("https basic auth password = %s", strings.Repeat("x", len(basicAuthPassword))) // Do not display the password.
+	}
+
+	jobs, err := cmd.Flags().GetInt("jobs")
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("jobs = %d", jobs)
+	if jobs > 1 {
+		// Concurrent spinners would overwrite each other.
+		logger.DisableSpinner()
+	}
+
+	offline, err := cmd.Flags().GetBool("offline")
+	if err != nil {
+		return nil, err
+	}
+	if !cmd.Flags().Changed("offline") {
+		if env := os.Getenv(offlineEnv); env != "" {
+			if offline, err = strconv.ParseBool(env); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", offlineEnv, err)
+			}
+		}
+	}
+	logger.Info("offline = %t", offline)
+
+	preferOffline, err := cmd.Flags().GetBool("prefer-offline")
+	if err != nil {
+		return nil, err
+	}
+	if preferOffline {
+		logger.Info("prefer offline = %t", preferOffline)
+	}
+	if offline && preferOffline {
+		return nil, errors.New("--offline cannot be used together with --prefer-offline")
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	cacheDir, err := cacheDir(cmd)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("cache dir = %s", cacheDir)
+
+	lockTimeout, err := cmd.Flags().GetDuration("lock-timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	return &resolver.Config{
+		UseHttps:                useHTTPS,
+		UseGitCredentialsHelper: useGitCredentials,
+		UseNetrc:                useNetrc,
+		HomeDir:                 homeDir,
+		CacheDir:                cacheDir,
+		LockTimeout:             lockTimeout,
+		Offline:                 offline,
+		PreferOffline:           preferOffline,
+		TargetDir:               pwd,
+		OutputDir:               pwd,
+		BasicAuthUsername:       basicAuthUsername,
+		BasicAuthPassword:       basicAuthPassword,
+		IdentityFile:            identityFile,
+		IdentityPassword:        password,
+		Jobs:                    jobs,
+	}, nil
+}
 
-		httpsProvider, err := conf.GetHttpsAuthProvider()
-		if err != nil {
-			return err
-		}
+func newResolver(conf *resolver.Config) (*resolver.Resolver, error) {
+	httpsProvider, err := conf.GetHttpsAuthProvider()
+	if err != nil {
+		return nil, err
+	}
 
-		sshProvider, err := conf.GetSshAuthProvider()
-		if err != nil {
-			return err
-		}
+	sshProvider, err := conf.GetSshAuthProvider()
+	if err != nil {
+		return nil, err
+	}
 
-		updateService, err := resolver.New(&conf, httpsProvider, sshProvider)
-		if err != nil {
-			return err
-		}
+	return resolver.New(conf, httpsProvider, sshProvider)
+}
 
-		return updateService.Resolve(isCleanupCache)
-	},
+// addResolverFlags registers the flags shared by the commands resolving dependencies.
+func addResolverFlags(flags *pflag.FlagSet) {
+	flags.StringP("identity-file", "i", "", "set the identity file for SSH")
+	flags.StringP("password", "p", "", "set the password for SSH")
+	flags.BoolP("use-https", "u", false, "use HTTPS to get dependencies.")
+	flags.BoolP("use-netrc", "n", true, "use netrc file for authentication")
+	flags.BoolP("use-git-credentials", "m", true, "use git credentials for authentication")
+	flags.StringP("basic-auth-username", "", "", "set the username with Basic Auth via HTTPS")
+	flags.StringP("basic-auth-password", "", "", "set the password or personal access token(when enabled 2FA) with Basic Auth via HTTPS")
+	flags.IntP("jobs", "j", 1, "number of repositories fetched concurrently")
+	flags.Bool("offline", false, "resolve from the cache only, without network access (or set "+offlineEnv+"=1)")
+	flags.Bool("prefer-offline", false, "fall back to the cache with a warning if a remote can't be reached")
+	addCacheFlags(flags)
 }
 
 func initDepCmd() {
-	upCmd.PersistentFlags().StringP("identity-file", "i", "", "set the identity file for SSH")
-	upCmd.PersistentFlags().StringP("password", "p", "", "set the password for SSH")
+	addResolverFlags(upCmd.PersistentFlags())
 	upCmd.PersistentFlags().BoolP("cleanup", "c", false, "cleanup cache before exec.")
-	upCmd.PersistentFlags().BoolP("use-https", "u", false, "use HTTPS to get dependencies.")
-	upCmd.PersistentFlags().BoolP("use-netrc", "n", true, "use netrc file for authentication")
-	upCmd.PersistentFlags().BoolP("use-git-credentials", "m", true, "use git credentials for authentication")
-	upCmd.PersistentFlags().StringP("basic-auth-username", "", "", "set the username with Basic Auth via HTTPS")
-	upCmd.PersistentFlags().StringP("basic-auth-password", "", "", "set the password or personal access token(when enabled 2FA) with Basic Auth via HTTPS")
+	upCmd.PersistentFlags().Bool("update", false, "ignore commits pinned in protodep.lock and resolve dependencies again")
+	upCmd.PersistentFlags().Bool("frozen", false, "verify vendored files against protodep.toml and protodep.lock instead of rewriting them")
+
+	addResolverFlags(updateCmd.PersistentFlags())
+
+	addResolverFlags(addCmd.PersistentFlags())
+	addCmd.PersistentFlags().String("name", "", "unique name referring to the dependency in logs and commands")
+	addCmd.PersistentFlags().String("path", "", "subdirectory of proto_outdir to vendor the files to")
+	addCmd.PersistentFlags().StringArray("include", nil, "file or glob to include (repeatable)")
+	addCmd.PersistentFlags().StringArray("ignore", nil, "file or glob to ignore (repeatable)")
+	addCmd.PersistentFlags().String("protocol", "", "protocol used to get the dependency (ssh or https)")
+
+	addResolverFlags(verifyCmd.PersistentFlags())
+
+	addResolverFlags(outdatedCmd.PersistentFlags())
+	outdatedCmd.PersistentFlags().Bool("json", false, "print the result as JSON")
 }
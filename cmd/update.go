@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update [dependency...]",
+	Short: "Resolve the named dependencies again and update protodep.lock and vendored files for them only",
+	Long: `Resolve the named dependencies again and update protodep.lock and vendored files for them only.
+A dependency is referred to by its name, target or local_folder. Without arguments every dependency is updated.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, err := resolverConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		updateService, err := newResolver(conf)
+		if err != nil {
+			return err
+		}
+
+		return updateService.Update(cmd.Context(), args)
+	},
+}
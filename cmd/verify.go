@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that vendored .proto files match protodep.toml and protodep.lock",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		conf, err := resolverConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		verifyService, err := newResolver(conf)
+		if err != nil {
+			return err
+		}
+
+		return verifyService.Verify(cmd.Context())
+	},
+}
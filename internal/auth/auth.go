@@ -48,9 +48,14 @@ type AuthProvider interface {
 type AuthProviderWithSSH struct {
 	pemFile  string
 	password string
+	// user is the ssh user, "git" if empty.
+	user string
 }
 
-type AuthProviderWithSSHAgent struct{}
+type AuthProviderWithSSHAgent struct {
+	// user is the ssh user, ssh.DefaultUsername if empty.
+	user string
+}
 
 type AuthProviderHTTPS struct {
 	username string
@@ -103,6 +108,25 @@ func NewAuthProvider(opt ...AuthOption) AuthProvider {
 	return authProvider
 }
 
+// WithSSHUser returns an ssh provider authenticating as user, e.g. the user of an ssh:// URL.
+// Other providers and an empty user leave the provider unchanged.
+func WithSSHUser(provider AuthProvider, user string) AuthProvider {
+	if user == "" {
+		return provider
+	}
+
+	switch p := provider.(type) {
+	case *AuthProviderWithSSH:
+		withUser := *p
+		withUser.user = user
+		return &withUser
+	case *AuthProviderWithSSHAgent:
+		return &AuthProviderWithSSHAgent{user: user}
+	default:
+		return provider
+	}
+}
+
 func (p *AuthProviderWithSSH) GetRepositoryURL(reponame string) string {
 	ep, err := transport.NewEndpoint("ssh://" + reponame + ".git")
 	if err != nil {
@@ -112,7 +136,11 @@ func (p *AuthProviderWithSSH) GetRepositoryURL(reponame string) string {
 }
 
 func (p *AuthProviderWithSSH) AuthMethod() (transport.AuthMethod, error) {
-	am, err := ssh.NewPublicKeysFromFile("git", p.pemFile, p.password)
+	user := p.user
+	if user == "" {
+		user = "git"
+	}
+	am, err := ssh.NewPublicKeysFromFile(user, p.pemFile, p.password)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +156,11 @@ func (p *AuthProviderWithSSHAgent) GetRepositoryURL(reponame string) string {
 }
 
 func (p *AuthProviderWithSSHAgent) AuthMethod() (transport.AuthMethod, error) {
-	aa, err := ssh.NewSSHAgentAuth(ssh.DefaultUsername)
+	user := p.user
+	if user == "" {
+		user = ssh.DefaultUsername
+	}
+	aa, err := ssh.NewSSHAgentAuth(user)
 	if err != nil {
 		panic(err)
 	}
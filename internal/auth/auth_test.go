@@ -1,8 +1,15 @@
 package auth
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,3 +33,32 @@ func TestGetRepositoryURLHTTPS(t *testing.T) {
 
 	require.Equal(t, "https://github.com/n-r-w/protodep.git", actual)
 }
+
+func TestWithSSHUser(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pemFile := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	provider := NewAuthProvider(WithPemFile(pemFile, ""))
+
+	method, err := provider.AuthMethod()
+	require.NoError(t, err)
+	require.Equal(t, "git", method.(*ssh.PublicKeys).User)
+
+	method, err = WithSSHUser(provider, "alice").AuthMethod()
+	require.NoError(t, err)
+	require.Equal(t, "alice", method.(*ssh.PublicKeys).User)
+
+	// The shared provider keeps its user.
+	method, err = provider.AuthMethod()
+	require.NoError(t, err)
+	require.Equal(t, "git", method.(*ssh.PublicKeys).User)
+
+	require.Equal(t, &AuthProviderWithSSHAgent{user: "alice"}, WithSSHUser(NewAuthProvider(), "alice"))
+
+	https := NewAuthProvider(WithHTTPS("user", "password"))
+	require.Same(t, https, WithSSHUser(https, "alice"))
+}
@@ -0,0 +1,267 @@
+// Package cache manages the directory of cached dependency repositories.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// metadataFile is kept in every cached repository next to the git files.
+const metadataFile = "protodep-cache.json"
+
+// Entry is a cached repository.
+type Entry struct {
+	// Repository is the path of the repository relative to the cache directory, e.g. github.com/org/repo.
+	Repository string
+	Path       string
+	Size       int64
+	// LastFetch is zero if the repository was never fetched since the cache was created by an older protodep.
+	LastFetch time.Time
+	// LastUse falls back to the modification time of the repository directory.
+	LastUse time.Time
+	// Configs are the protodep.toml files that used the repository and still exist.
+	Configs []string
+}
+
+type metadata struct {
+	LastFetch time.Time `json:"last_fetch"`
+	LastUse   time.Time `json:"last_use"`
+	Configs   []string  `json:"configs"`
+}
+
+// Record notes that the protodep.toml at configPath used the cached repository, and whether it was fetched.
+func Record(dir, repository, configPath string, fetched bool) error {
+	path := filepath.Join(dir, repository, metadataFile)
+
+	meta, err := readMetadata(path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	meta.LastUse = now
+	if fetched {
+		meta.LastFetch = now
+	}
+	if !slices.Contains(meta.Configs, configPath) {
+		meta.Configs = append(meta.Configs, configPath)
+		sort.Strings(meta.Configs)
+	}
+
+	content, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", path, err)
+	}
+
+	// Other processes may record the same repository, a rename never leaves them a partial file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), metadataFile+".*")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// List returns the cached repositories sorted by their path.
+func List(dir string) ([]Entry, error) {
+	var entries []Entry
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() || !isRepository(path) {
+			return nil
+		}
+
+		entry, err := readEntry(dir, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Remove deletes a cached repository, given by its path relative to the cache directory.
+// It waits for other processes using the repository.
+func Remove(ctx context.Context, dir, repository string, lockTimeout time.Duration) error {
+	path := filepath.Join(dir, filepath.FromSlash(repository))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%s is not a cached repository", repository)
+	}
+	if !isRepository(path) {
+		return fmt.Errorf("%s is not a cached repository", repository)
+	}
+
+	lock, err := LockRepository(ctx, path, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	// Processes waiting for the lock notice that the file is gone and lock a new one.
+	_ = os.Remove(path + lockSuffix)
+
+	// Remove the host and owner directories left empty.
+	for parent := filepath.Dir(path); parent != dir && parent != "."; parent = filepath.Dir(parent) {
+		if err := os.Remove(parent); err != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Prune removes the repositories not used for longer than olderThan, then the least recently used ones until
+// the cache fits into maxSize bytes. Zero values disable the respective limit. It returns the removed entries.
+func Prune(ctx context.Context, dir string, olderThan time.Duration, maxSize int64, lockTimeout time.Duration) ([]Entry, error) {
+	entries, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUse.Before(entries[j].LastUse)
+	})
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	var removed []Entry
+	deadline := time.Now().Add(-olderThan)
+	for _, e := range entries {
+		expired := olderThan > 0 && e.LastUse.Before(deadline)
+		oversized := maxSize > 0 && total > maxSize
+		if !expired && !oversized {
+			continue
+		}
+
+		if err := Remove(ctx, dir, e.Repository, lockTimeout); err != nil {
+			return removed, err
+		}
+		total -= e.Size
+		removed = append(removed, e)
+	}
+
+	return removed, nil
+}
+
+// isRepository reports whether path is a git repository: a bare one, or a clone with a worktree left by older
+// versions, whose worktree belongs to the repository.
+func isRepository(path string) bool {
+	return isGitDir(path) || isGitDir(filepath.Join(path, ".git"))
+}
+
+func isGitDir(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); err != nil {
+		return false
+	}
+	stat, err := os.Stat(filepath.Join(path, "objects"))
+	return err == nil && stat.IsDir()
+}
+
+func readEntry(dir, path string) (Entry, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	meta, err := readMetadata(filepath.Join(path, metadataFile))
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{
+		Repository: filepath.ToSlash(rel),
+		Path:       path,
+		LastFetch:  meta.LastFetch,
+		LastUse:    meta.LastUse,
+	}
+
+	for _, c := range meta.Configs {
+		if _, err := os.Stat(c); err == nil {
+			entry.Configs = append(entry.Configs, c)
+		}
+	}
+
+	if entry.LastUse.IsZero() {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.LastUse = stat.ModTime()
+	}
+
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry.Size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return Entry{}, fmt.Errorf("size of %s: %w", path, err)
+	}
+
+	return entry, nil
+}
+
+// readMetadata returns empty metadata if the file doesn't exist.
+func readMetadata(path string) (*metadata, error) {
+	var meta metadata
+
+	content, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return &meta, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	return &meta, nil
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newCachedRepository creates a directory looking like a bare repository with a file of the given size.
+func newCachedRepository(t *testing.T, dir, repository string, size int) {
+	t.Helper()
+
+	path := filepath.Join(dir, filepath.FromSlash(repository))
+	require.NoError(t, os.MkdirAll(filepath.Join(path, "objects"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "HEAD"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "objects", "pack"), make([]byte, size), 0o644))
+}
+
+func writeMetadata(t *testing.T, dir, repository string, meta metadata) {
+	t.Helper()
+
+	content, err := json.Marshal(meta)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.FromSlash(repository), metadataFile), content, 0o644))
+}
+
+func TestRecordList(t *testing.T) {
+	dir := t.TempDir()
+	newCachedRepository(t, dir, "github.com/org/repo", 100)
+	newCachedRepository(t, dir, "gitlab.com/group/subgroup/repo", 10)
+
+	configPath := filepath.Join(t.TempDir(), "protodep.toml")
+	require.NoError(t, os.WriteFile(configPath, nil, 0o644))
+	gonePath := filepath.Join(t.TempDir(), "gone", "protodep.toml")
+
+	require.NoError(t, Record(dir, "github.com/org/repo", configPath, true))
+	require.NoError(t, Record(dir, "github.com/org/repo", gonePath, false))
+	require.NoError(t, Record(dir, "github.com/org/repo", configPath, false))
+
+	entries, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, "github.com/org/repo", entries[0].Repository)
+	require.Equal(t, []string{configPath}, entries[0].Configs)
+	require.False(t, entries[0].LastFetch.IsZero())
+	require.Greater(t, entries[0].Size, int64(100))
+
+	require.Equal(t, "gitlab.com/group/subgroup/repo", entries[1].Repository)
+	require.True(t, entries[1].LastFetch.IsZero())
+	require.False(t, entries[1].LastUse.IsZero())
+	require.Equal(t, int64(10), entries[1].Size)
+
+	entries, err = List(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestRemove(t *testing.T) {
+	dir := t.TempDir()
+	newCachedRepository(t, dir, "github.com/org/repo", 1)
+	newCachedRepository(t, dir, "github.com/org/other", 1)
+
+	require.Error(t, Remove(context.Background(), dir, "github.com/org", 0))
+	require.Error(t, Remove(context.Background(), dir, "../outside", 0))
+	require.NoError(t, Remove(context.Background(), dir, "github.com/org/repo", 0))
+	require.NoDirExists(t, filepath.Join(dir, "github.com/org/repo"))
+
+	require.NoError(t, Remove(context.Background(), dir, "github.com/org/other", 0))
+	require.NoDirExists(t, filepath.Join(dir, "github.com"))
+	require.DirExists(t, dir)
+}
+
+func TestLegacyClone(t *testing.T) {
+	dir := t.TempDir()
+	// Older versions cloned the repositories with a worktree.
+	newCachedRepository(t, dir, "github.com/org/repo/.git", 10)
+	path := filepath.Join(dir, "github.com/org/repo")
+	require.NoError(t, os.MkdirAll(filepath.Join(path, "proto"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "proto", "foo.proto"), make([]byte, 5), 0o644))
+
+	entries, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "github.com/org/repo", entries[0].Repository)
+	require.Equal(t, int64(15), entries[0].Size)
+
+	require.NoError(t, Remove(context.Background(), dir, "github.com/org/repo", 0))
+	require.NoDirExists(t, path)
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	newCachedRepository(t, dir, "github.com/org/old", 1000)
+	writeMetadata(t, dir, "github.com/org/old", metadata{LastUse: now.Add(-60 * 24 * time.Hour)})
+	newCachedRepository(t, dir, "github.com/org/recent", 1000)
+	writeMetadata(t, dir, "github.com/org/recent", metadata{LastUse: now.Add(-time.Hour)})
+	newCachedRepository(t, dir, "github.com/org/older", 1000)
+	writeMetadata(t, dir, "github.com/org/older", metadata{LastUse: now.Add(-2 * time.Hour)})
+
+	removed, err := Prune(context.Background(), dir, 30*24*time.Hour, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	require.Equal(t, "github.com/org/old", removed[0].Repository)
+
+	entries, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	removed, err = Prune(context.Background(), dir, 0, entries[1].Size+1, 0)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	require.Equal(t, "github.com/org/older", removed[0].Repository)
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"5GB":   5 << 30,
+		"5g":    5 << 30,
+		"1.5M":  3 << 19,
+		"100":   100,
+		"10 KB": 10 << 10,
+		"2TiB":  2 << 40,
+		"7B":    7,
+	}
+	for s, expected := range cases {
+		size, err := ParseSize(s)
+		require.NoError(t, err, s)
+		require.Equal(t, expected, size, s)
+	}
+
+	_, err := ParseSize("lots")
+	require.Error(t, err)
+}
+
+func TestParseAge(t *testing.T) {
+	age, err := ParseAge("30d")
+	require.NoError(t, err)
+	require.Equal(t, 30*24*time.Hour, age)
+
+	age, err = ParseAge("12h")
+	require.NoError(t, err)
+	require.Equal(t, 12*time.Hour, age)
+
+	_, err = ParseAge("soon")
+	require.Error(t, err)
+}
+
+func TestDir(t *testing.T) {
+	cacheHome := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+	t.Setenv(EnvDir, "")
+	defaultDir := filepath.Join(cacheHome, "protodep")
+
+	t.Run("flag", func(t *testing.T) {
+		t.Setenv(EnvDir, "/env/cache")
+
+		dir, err := Dir("/flag/cache", t.TempDir())
+		require.NoError(t, err)
+		require.Equal(t, "/flag/cache", dir)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv(EnvDir, "/env/cache")
+
+		dir, err := Dir("", t.TempDir())
+		require.NoError(t, err)
+		require.Equal(t, "/env/cache", dir)
+	})
+
+	t.Run("default", func(t *testing.T) {
+		dir, err := Dir("", t.TempDir())
+		require.NoError(t, err)
+		require.Equal(t, defaultDir, dir)
+		require.NoDirExists(t, defaultDir)
+	})
+
+	t.Run("migrate", func(t *testing.T) {
+		homeDir := t.TempDir()
+		newCachedRepository(t, LegacyDir(homeDir), "github.com/org/repo", 10)
+
+		dir, err := Dir("", homeDir)
+		require.NoError(t, err)
+		require.Equal(t, defaultDir, dir)
+		require.NoDirExists(t, LegacyDir(homeDir))
+
+		entries, err := List(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "github.com/org/repo", entries[0].Repository)
+
+		// The default directory exists now, a new legacy cache is left alone.
+		newCachedRepository(t, LegacyDir(homeDir), "github.com/org/other", 10)
+
+		dir, err = Dir("", homeDir)
+		require.NoError(t, err)
+		require.Equal(t, defaultDir, dir)
+		require.DirExists(t, LegacyDir(homeDir))
+	})
+}
+
+func TestLockRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "github.com/org/repo")
+
+	lock, err := LockRepository(context.Background(), path, time.Second)
+	require.NoError(t, err)
+
+	_, err = LockRepository(context.Background(), path, 200*time.Millisecond)
+	require.ErrorContains(t, err, "timed out after 200ms")
+	require.ErrorContains(t, err, fmt.Sprintf("locked by pid %d", os.Getpid()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = LockRepository(ctx, path, time.Minute)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// A waiting process gets the lock as soon as it is released.
+	locked := make(chan error, 1)
+	go func() {
+		second, err := LockRepository(context.Background(), path, 5*time.Second)
+		if err == nil {
+			second.Unlock()
+		}
+		locked <- err
+	}()
+	time.Sleep(2 * lockPollInterval)
+	lock.Unlock()
+	require.NoError(t, <-locked)
+}
+
+func TestRemoveLocked(t *testing.T) {
+	dir := t.TempDir()
+	newCachedRepository(t, dir, "github.com/org/repo", 1)
+
+	lock, err := LockRepository(context.Background(), filepath.Join(dir, "github.com/org/repo"), 0)
+	require.NoError(t, err)
+
+	require.ErrorContains(t, Remove(context.Background(), dir, "github.com/org/repo", 200*time.Millisecond), "timed out")
+	require.DirExists(t, filepath.Join(dir, "github.com/org/repo"))
+
+	lock.Unlock()
+	require.NoError(t, Remove(context.Background(), dir, "github.com/org/repo", 0))
+	require.NoDirExists(t, filepath.Join(dir, "github.com"))
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// EnvDir is the environment variable overriding the default cache directory.
+const EnvDir = "PROTODEP_CACHE_DIR"
+
+// legacyDirName is the cache directory in the home directory used by older versions.
+const legacyDirName = ".protodep"
+
+// LegacyDir returns the cache directory in the home directory used by older versions.
+func LegacyDir(homeDir string) string {
+	return filepath.Join(homeDir, legacyDirName)
+}
+
+// Dir returns the cache directory: dir if set, $PROTODEP_CACHE_DIR otherwise, and protodep in the user cache
+// directory ($XDG_CACHE_HOME, ~/.cache on Linux) by default. A cache left by an older version in homeDir is
+// moved to the default directory. If it cannot be moved, e.g. to another file system, it keeps being used.
+func Dir(dir, homeDir string) (string, error) {
+	if dir != "" {
+		return filepath.Abs(dir)
+	}
+	if env := os.Getenv(EnvDir); env != "" {
+		return filepath.Abs(env)
+	}
+
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cache directory: %w, set %s or --cache-dir", err, EnvDir)
+	}
+	dir = filepath.Join(userCacheDir, "protodep")
+
+	legacy := LegacyDir(homeDir)
+	if homeDir == "" || !isDir(legacy) {
+		return dir, nil
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		logger.Warn("%s is not used anymore, the cache is in %s, remove it to free space", legacy, dir)
+		return dir, nil
+	}
+
+	if err := migrate(legacy, dir); err != nil {
+		logger.Warn("keep using the cache in %s: %v", legacy, err)
+		return legacy, nil
+	}
+	logger.Info("moved the cache from %s to %s", legacy, dir)
+
+	return dir, nil
+}
+
+func migrate(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0o750); err != nil { //nolint:gomnd
+		return fmt.Errorf("create %s: %w", filepath.Dir(to), err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("move to %s: %w", to, err)
+	}
+	return nil
+}
+
+func isDir(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.IsDir()
+}
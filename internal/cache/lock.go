@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// DefaultLockTimeout is how long a process waits for another one to release a cached repository.
+const DefaultLockTimeout = 5 * time.Minute
+
+// lockPollInterval is how often a busy lock is tried again.
+const lockPollInterval = 100 * time.Millisecond
+
+// lockSuffix is appended to the repository directory to get its lock file.
+const lockSuffix = ".lock"
+
+// Lock is an inter-process lock of a cached repository. It is held on a lock file next to the repository
+// directory, which describes the holding process for the ones waiting.
+type Lock struct {
+	file *os.File
+}
+
+// lockHolder is the content of a lock file.
+type lockHolder struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+func (h *lockHolder) String() string {
+	return fmt.Sprintf("pid %d on %s (%s) since %s", h.PID, h.Host, h.Command, h.Since.Local().Format(time.DateTime))
+}
+
+// LockRepository locks the cached repository at path, waiting up to timeout for other processes holding it.
+// A timeout of zero means DefaultLockTimeout.
+func LockRepository(ctx context.Context, path string, timeout time.Duration) (*Lock, error) {
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+
+	lockPath := path + lockSuffix
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o750); err != nil { //nolint:gomnd
+		return nil, fmt.Errorf("create %s: %w", filepath.Dir(lockPath), err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		lock, err := tryLock(lockPath)
+		if err != nil {
+			return nil, err
+		}
+		if lock != nil {
+			return lock, nil
+		}
+
+		holder := describeHolder(lockPath)
+		if !waiting {
+			logger.Info("waiting for %s, locked by %s", path, holder)
+			waiting = true
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for %s, locked by %s", timeout, path, holder)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Unlock releases the lock. The lock file is kept for the next process.
+func (l *Lock) Unlock() {
+	_ = unlockFile(l.file)
+	_ = l.file.Close()
+}
+
+// tryLock returns nil if the lock is held by another process.
+func tryLock(lockPath string) (*Lock, error) {
+	f, err := os.OpenFile(filepath.Clean(lockPath), os.O_RDWR|os.O_CREATE, 0o644) //nolint:gosec,gomnd
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", lockPath, err)
+	}
+
+	locked, err := lockFile(f)
+	if err != nil || !locked {
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("lock %s: %w", lockPath, err)
+		}
+		return nil, nil
+	}
+
+	// The previous holder may have removed the file together with the repository after it was opened.
+	opened, err := f.Stat()
+	if err != nil {
+		_ = unlockFile(f)
+		_ = f.Close()
+		return nil, fmt.Errorf("stat %s: %w", lockPath, err)
+	}
+	if current, err := os.Stat(lockPath); err != nil || !os.SameFile(opened, current) {
+		_ = unlockFile(f)
+		_ = f.Close()
+		return tryLock(lockPath)
+	}
+
+	host, _ := os.Hostname()
+	content, err := json.Marshal(lockHolder{
+		PID:     os.Getpid(),
+		Host:    host,
+		Command: strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " "),
+		Since:   time.Now(),
+	})
+	if err == nil {
+		err = writeHolder(f, content)
+	}
+	if err != nil {
+		_ = unlockFile(f)
+		_ = f.Close()
+		return nil, fmt.Errorf("write %s: %w", lockPath, err)
+	}
+
+	return &Lock{file: f}, nil
+}
+
+func writeHolder(f *os.File, content []byte) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt(content, 0)
+	return err
+}
+
+// describeHolder names the process holding a lock file, as far as it is known.
+func describeHolder(lockPath string) string {
+	content, err := os.ReadFile(filepath.Clean(lockPath))
+	if err != nil {
+		return "another process"
+	}
+
+	var holder lockHolder
+	if err := json.Unmarshal(content, &holder); err != nil || holder.PID == 0 {
+		return "another process"
+	}
+
+	return holder.String()
+}
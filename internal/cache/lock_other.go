@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package cache
+
+import "os"
+
+// lockFile doesn't lock on platforms without file locks.
+func lockFile(*os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
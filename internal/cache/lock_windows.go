@@ -0,0 +1,29 @@
+//go:build windows
+
+package cache
+
+import (
+	"errors"
+	"math"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockedRange is far past the content of the lock file, so that waiting processes can still read the holder.
+const lockedRange = math.MaxUint32
+
+// lockFile takes an exclusive lock on f without blocking. It returns false if another process holds it.
+func lockFile(f *os.File) (bool, error) {
+	ol := windows.Overlapped{Offset: lockedRange, OffsetHigh: lockedRange}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(f *os.File) error {
+	ol := windows.Overlapped{Offset: lockedRange, OffsetHigh: lockedRange}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &ol)
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sizeUnits = []struct {
+	name     string
+	suffixes []string
+	bytes    int64
+}{
+	{"TiB", []string{"TIB", "TB", "T"}, 1 << 40}, //nolint:gomnd
+	{"GiB", []string{"GIB", "GB", "G"}, 1 << 30}, //nolint:gomnd
+	{"MiB", []string{"MIB", "MB", "M"}, 1 << 20}, //nolint:gomnd
+	{"KiB", []string{"KIB", "KB", "K"}, 1 << 10}, //nolint:gomnd
+	{"B", []string{"B"}, 1},
+}
+
+// ParseSize parses a size such as "5GB" or "500M". Units are powers of 1024, a number without a unit is in bytes.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+
+	for _, unit := range sizeUnits {
+		found := false
+		for _, suffix := range unit.suffixes {
+			if strings.HasSuffix(value, suffix) {
+				value = strings.TrimSpace(strings.TrimSuffix(value, suffix))
+				multiplier = unit.bytes
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize formats a number of bytes for humans.
+func FormatSize(size int64) string {
+	for _, unit := range sizeUnits[:len(sizeUnits)-1] {
+		if size >= unit.bytes {
+			return fmt.Sprintf("%.1f %s", float64(size)/float64(unit.bytes), unit.name)
+		}
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// ParseAge parses a duration such as "30d" or "12h". Besides the units of time.ParseDuration, "d" means days.
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age '%s'", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil //nolint:gomnd
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age '%s'", s)
+	}
+	return d, nil
+}
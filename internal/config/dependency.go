@@ -8,15 +8,23 @@ import (
 	"github.com/BurntSushi/toml"
 )
 
+// FileName is the name of the configuration file.
+const FileName = "protodep.toml"
+
+// LockFileName is the name of the lock file written next to protodep.toml.
+const LockFileName = "protodep.lock"
+
 type Dependency struct {
 	targetDir string
 	tomlPath  string
+	lockPath  string
 }
 
 func NewDependency(targetDir string) *Dependency {
 	return &Dependency{
 		targetDir: targetDir,
-		tomlPath:  filepath.Join(targetDir, "protodep.toml"),
+		tomlPath:  filepath.Join(targetDir, FileName),
+		lockPath:  filepath.Join(targetDir, LockFileName),
 	}
 }
 
@@ -26,11 +34,26 @@ func (d *Dependency) Load() (*ProtoDep, error) {
 		return nil, fmt.Errorf("load %s: %w", d.tomlPath, err)
 	}
 
+	return parse(content, d.targetDir)
+}
+
+// Parse decodes and validates the content of protodep.toml that isn't on the filesystem, e.g. of a dependency.
+// Relative paths of local repositories are kept relative.
+func Parse(content []byte) (*ProtoDep, error) {
+	return parse(content, "")
+}
+
+// parse decodes and validates the content of protodep.toml in dir.
+func parse(content []byte, dir string) (*ProtoDep, error) {
 	var conf ProtoDep
 	if _, err := toml.Decode(string(content), &conf); err != nil {
 		return nil, fmt.Errorf("decode toml: %w", err)
 	}
 
+	if err := conf.applyURLs(dir); err != nil {
+		return nil, fmt.Errorf("found invalid configuration: %w", err)
+	}
+
 	if err := conf.Validate(); err != nil {
 		return nil, fmt.Errorf("found invalid configuration: %w", err)
 	}
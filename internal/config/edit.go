@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	tableHeaderPattern        = regexp.MustCompile(`^\s*\[\[?\s*([A-Za-z0-9_.\-"' ]+?)\s*\]\]?\s*(#.*)?$`)
+	dependenciesHeaderPattern = regexp.MustCompile(`^\s*\[\[\s*dependencies\s*\]\]\s*(#.*)?$`)
+)
+
+// AppendDependency adds a [[dependencies]] table to the end of protodep.toml. The rest of the file,
+// including comments and the order of the dependencies, is kept as is.
+func (d *Dependency) AppendDependency(dep *ProtoDepDependency) error {
+	content, err := os.ReadFile(filepath.Clean(d.tomlPath))
+	if err != nil {
+		return fmt.Errorf("load %s: %w", d.tomlPath, err)
+	}
+
+	text := string(content)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	text += "\n" + FormatDependency(dep)
+
+	return d.write(text)
+}
+
+// RemoveDependency removes the [[dependencies]] table with the given index from protodep.toml, together with
+// the comment lines right above it. The rest of the file is kept as is.
+func (d *Dependency) RemoveDependency(index int) error {
+	content, err := os.ReadFile(filepath.Clean(d.tomlPath))
+	if err != nil {
+		return fmt.Errorf("load %s: %w", d.tomlPath, err)
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+
+	// starts are the first lines of the tables, including their leading comments.
+	var (
+		starts     []int
+		dependency []bool
+	)
+	for i, line := range lines {
+		if !tableHeaderPattern.MatchString(line) {
+			continue
+		}
+		start := i
+		for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "#") {
+			start--
+		}
+		starts = append(starts, start)
+		dependency = append(dependency, dependenciesHeaderPattern.MatchString(line))
+	}
+
+	table := -1
+	for i, isDependency := range dependency {
+		if !isDependency {
+			continue
+		}
+		if index == 0 {
+			table = i
+			break
+		}
+		index--
+	}
+	if table < 0 {
+		return fmt.Errorf("dependency not found in %s", d.tomlPath)
+	}
+
+	end := len(lines)
+	if table+1 < len(starts) {
+		end = starts[table+1]
+	}
+
+	text := strings.Join(lines[:starts[table]], "") + strings.Join(lines[end:], "")
+	if end == len(lines) {
+		// Don't leave the blank lines that separated the removed table at the end of the file.
+		text = strings.TrimRight(text, "\n") + "\n"
+	}
+
+	return d.write(text)
+}
+
+// write replaces protodep.toml with content after checking that it is a valid configuration.
+func (d *Dependency) write(content string) error {
+	if _, err := parse([]byte(content), d.targetDir); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(d.tomlPath, []byte(content))
+}
+
+// writeFileAtomic writes to a temporary file first, so that an interrupted write never leaves a truncated file.
+func writeFileAtomic(path string, content []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0o644); err != nil { //nolint:gosec,gomnd
+		return fmt.Errorf("write %s: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	return nil
+}
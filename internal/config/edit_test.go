@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const editedToml = `# Vendored files
+proto_outdir = "./proto"
+
+# The first one
+[[dependencies]]
+  target = "github.com/org/first"
+  branch = "main" # keep it on main
+
+[[dependencies]]
+  target = "github.com/org/second"
+  includes = [
+    "a.proto",
+  ]
+
+# The last one
+[[dependencies]]
+  local_folder = "./api"
+`
+
+func TestAppendDependency(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte(editedToml), 0o644))
+
+	dep := NewDependency(dir)
+	require.NoError(t, dep.AppendDependency(&ProtoDepDependency{Target: "github.com/org/new", Revision: "v1.0.0", Path: "new"}))
+
+	content, err := os.ReadFile(filepath.Join(dir, FileName))
+	require.NoError(t, err)
+	require.Equal(t, editedToml+`
+[[dependencies]]
+  target = "github.com/org/new"
+  revision = "v1.0.0"
+  path = "new"
+`, string(content))
+}
+
+func TestRemoveDependency(t *testing.T) {
+	cases := []struct {
+		index    int
+		expected string
+	}{
+		{0, `# Vendored files
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/org/second"
+  includes = [
+    "a.proto",
+  ]
+
+# The last one
+[[dependencies]]
+  local_folder = "./api"
+`},
+		{1, `# Vendored files
+proto_outdir = "./proto"
+
+# The first one
+[[dependencies]]
+  target = "github.com/org/first"
+  branch = "main" # keep it on main
+
+# The last one
+[[dependencies]]
+  local_folder = "./api"
+`},
+		{2, `# Vendored files
+proto_outdir = "./proto"
+
+# The first one
+[[dependencies]]
+  target = "github.com/org/first"
+  branch = "main" # keep it on main
+
+[[dependencies]]
+  target = "github.com/org/second"
+  includes = [
+    "a.proto",
+  ]
+`},
+	}
+
+	for _, c := range cases {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte(editedToml), 0o644))
+
+		require.NoError(t, NewDependency(dir).RemoveDependency(c.index))
+
+		content, err := os.ReadFile(filepath.Join(dir, FileName))
+		require.NoError(t, err)
+		require.Equal(t, c.expected, string(content), c.index)
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte(editedToml), 0o644))
+	require.Error(t, NewDependency(dir).RemoveDependency(3))
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+const lockHeader = "# This file is generated by protodep. Do not edit it manually.\n\n"
+
+// ProtoDepLock is the content of protodep.lock.
+type ProtoDepLock struct {
+	Dependencies []LockedDependency `toml:"dependencies"`
+}
+
+// LockedDependency pins a single dependency of protodep.toml.
+type LockedDependency struct {
+	Name        string `toml:"name,omitempty"`
+	Target      string `toml:"target,omitempty"`
+	LocalFolder string `toml:"local_folder,omitempty"`
+	Path        string `toml:"path,omitempty"`
+	// Branch, Revision and Version are copied from protodep.toml, so that a changed requirement invalidates the pin.
+	Branch   string `toml:"branch,omitempty"`
+	Revision string `toml:"revision,omitempty"`
+	Version  string `toml:"version,omitempty"`
+	// Ref is the reference the commit was resolved from. For a version constraint it is the chosen tag.
+	Ref    string `toml:"ref,omitempty"`
+	Commit string `toml:"commit,omitempty"`
+	URL    string `toml:"url,omitempty"`
+	// Via lists the names of the dependencies that pulled in a transitive dependency, starting from protodep.toml.
+	Via   []string     `toml:"via,omitempty"`
+	Files []LockedFile `toml:"files"`
+}
+
+// LockedFile is a vendored file. Path is relative to proto_outdir and always uses forward slashes.
+type LockedFile struct {
+	Path   string `toml:"path"`
+	SHA256 string `toml:"sha256"`
+}
+
+// Matches reports whether the lock entry was produced for the dependency.
+func (l *LockedDependency) Matches(dep *ProtoDepDependency) bool {
+	return l.Target == dep.Target && l.LocalFolder == dep.LocalFolder && l.Path == dep.Path
+}
+
+// IsPinned reports whether the lock entry can be reused for the dependency without resolving it again.
+func (l *LockedDependency) IsPinned(dep *ProtoDepDependency) bool {
+	return l.Commit != "" && l.Branch == dep.Branch && l.Revision == dep.Revision && l.Version == dep.Version
+}
+
+// Find returns the lock entry of the dependency or nil.
+func (l *ProtoDepLock) Find(dep *ProtoDepDependency) *LockedDependency {
+	for i := range l.Dependencies {
+		if l.Dependencies[i].Matches(dep) {
+			return &l.Dependencies[i]
+		}
+	}
+	return nil
+}
+
+// LoadLock reads protodep.lock. A missing file results in an empty lock.
+func (d *Dependency) LoadLock() (*ProtoDepLock, error) {
+	content, err := os.ReadFile(filepath.Clean(d.lockPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &ProtoDepLock{}, nil
+		}
+		return nil, fmt.Errorf("load %s: %w", d.lockPath, err)
+	}
+
+	var lock ProtoDepLock
+	if _, err := toml.Decode(string(content), &lock); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", d.lockPath, err)
+	}
+	if err := lock.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", d.lockPath, err)
+	}
+
+	return &lock, nil
+}
+
+// validate rejects file paths leading outside proto_outdir, since the files of the lock are removed on updates.
+func (l *ProtoDepLock) validate() error {
+	for _, dep := range l.Dependencies {
+		for _, f := range dep.Files {
+			if !Inside(f.Path) {
+				owner := ProtoDepDependency{Name: dep.Name, Target: dep.Target, LocalFolder: dep.LocalFolder}
+				return fmt.Errorf("file %s of %s is outside proto_outdir", f.Path, owner.DisplayName())
+			}
+		}
+	}
+	return nil
+}
+
+// SaveLock writes protodep.lock next to protodep.toml.
+func (d *Dependency) SaveLock(lock *ProtoDepLock) error {
+	var buf bytes.Buffer
+	buf.WriteString(lockHeader)
+	if err := toml.NewEncoder(&buf).Encode(lock); err != nil {
+		return fmt.Errorf("encode lock: %w", err)
+	}
+
+	return writeFileAtomic(d.lockPath, buf.Bytes())
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	target := NewDependency(t.TempDir())
+
+	empty, err := target.LoadLock()
+	require.NoError(t, err)
+	require.Empty(t, empty.Dependencies)
+
+	lock := &ProtoDepLock{
+		Dependencies: []LockedDependency{
+			{
+				Target: "github.com/protocolbuffers/protobuf/src",
+				Branch: "master",
+				Ref:    "refs/heads/master",
+				Commit: "0123456789abcdef0123456789abcdef01234567",
+				URL:    "https://github.com/protocolbuffers/protobuf.git",
+				Files: []LockedFile{
+					{Path: "google/protobuf/empty.proto", SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+				},
+			},
+			{
+				LocalFolder: "./api",
+				Path:        "api",
+			},
+		},
+	}
+	require.NoError(t, target.SaveLock(lock))
+
+	actual, err := target.LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, lock.Dependencies[0], actual.Dependencies[0])
+	require.Equal(t, "./api", actual.Dependencies[1].LocalFolder)
+
+	dep := ProtoDepDependency{Target: "github.com/protocolbuffers/protobuf/src", Branch: "master"}
+	found := actual.Find(&dep)
+	require.NotNil(t, found)
+	require.True(t, found.IsPinned(&dep))
+
+	dep.Branch = "main"
+	require.False(t, found.IsPinned(&dep))
+
+	require.Nil(t, actual.Find(&ProtoDepDependency{Target: "github.com/protocolbuffers/protobuf/src", Path: "other"}))
+}
+
+func TestLoadLockRejectsOutsidePaths(t *testing.T) {
+	target := NewDependency(t.TempDir())
+
+	for _, path := range []string{"../../README.proto", "/etc/passwd.proto"} {
+		require.NoError(t, target.SaveLock(&ProtoDepLock{Dependencies: []LockedDependency{{
+			Target: "github.com/org/repo",
+			Files:  []LockedFile{{Path: path}},
+		}}}))
+
+		_, err := target.LoadLock()
+		require.ErrorContains(t, err, "file "+path+" of github.com/org/repo is outside proto_outdir")
+	}
+}
@@ -0,0 +1,15 @@
+package config
+
+import "path/filepath"
+
+// Inside reports whether the relative path p, with slash or OS separators, stays inside the directory
+// it is relative to. The check is lexical, symbolic links aren't followed.
+func Inside(p string) bool {
+	return filepath.IsLocal(filepath.FromSlash(p))
+}
+
+// Within reports whether the path p is dir or a path inside it. Both are either absolute or relative.
+func Within(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && Inside(rel)
+}
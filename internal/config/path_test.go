@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInside(t *testing.T) {
+	require.True(t, Inside("."))
+	require.True(t, Inside("proto/foo"))
+	require.True(t, Inside("proto/../foo"))
+	require.False(t, Inside(".."))
+	require.False(t, Inside("../foo"))
+	require.False(t, Inside("proto/../../foo"))
+	require.False(t, Inside("/proto"))
+	require.False(t, Inside(""))
+}
+
+func TestWithin(t *testing.T) {
+	require.True(t, Within("proto", "."))
+	require.True(t, Within("proto", "proto"))
+	require.True(t, Within("proto/foo", "proto"))
+	require.False(t, Within("protos/foo", "proto"))
+	require.False(t, Within(".", "proto"))
+	require.False(t, Within("/proto/foo", "proto"))
+}
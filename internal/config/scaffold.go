@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// DefaultProtoOutdir is the proto_outdir of a new protodep.toml.
+const DefaultProtoOutdir = "./proto"
+
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// ParseDependencySpec parses a dependency given as "target@rev" on the command line.
+// rev is a version constraint if it starts with an operator or lists several constraints, a revision if it looks like
+// a commit hash or a semantic version tag, and a branch otherwise. Without rev the default branch is used.
+// The guess is made without the remote, add checks it against the remote references.
+func ParseDependencySpec(spec string) (ProtoDepDependency, error) {
+	target, rev, _ := strings.Cut(spec, "@")
+	if target == "" {
+		return ProtoDepDependency{}, fmt.Errorf("invalid dependency '%s', expected target@rev", spec)
+	}
+
+	dep := ProtoDepDependency{Target: target}
+
+	switch {
+	case rev == "":
+	case strings.ContainsAny(rev[:1], "^~<>=!*") || strings.Contains(rev, ","):
+		dep.Version = rev
+		if _, err := dep.VersionConstraint(); err != nil {
+			return ProtoDepDependency{}, err
+		}
+	case commitPattern.MatchString(rev):
+		dep.Revision = rev
+	default:
+		if _, err := semver.NewVersion(rev); err == nil {
+			dep.Revision = rev
+		} else {
+			dep.Branch = rev
+		}
+	}
+
+	return dep, nil
+}
+
+// FormatDependency renders a [[dependencies]] table of protodep.toml.
+func FormatDependency(dep *ProtoDepDependency) string {
+	var b strings.Builder
+	b.WriteString("[[dependencies]]\n")
+
+	field := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  %s = %s\n", key, strconv.Quote(value))
+		}
+	}
+	list := func(key string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		quoted := make([]string, 0, len(values))
+		for _, v := range values {
+			quoted = append(quoted, strconv.Quote(v))
+		}
+		fmt.Fprintf(&b, "  %s = [%s]\n", key, strings.Join(quoted, ", "))
+	}
+
+	field("name", dep.Name)
+	if dep.URL != "" {
+		// The target is derived from url.
+		field("url", dep.URL)
+		field("subdir", dep.Subdir)
+	} else {
+		field("target", dep.Target)
+	}
+	field("local_folder", dep.LocalFolder)
+	field("subgroup", dep.Subgroup)
+	field("branch", dep.Branch)
+	field("revision", dep.Revision)
+	field("version", dep.Version)
+	field("path", dep.Path)
+	list("includes", dep.Includes)
+	list("ignores", dep.Ignores)
+	list("extra_paths", dep.ExtraPaths)
+	field("protocol", dep.Protocol)
+
+	return b.String()
+}
+
+// Scaffold renders a new protodep.toml. protoDirs are the directories of the project containing .proto files,
+// they are listed so that proto_outdir is kept apart from them.
+func Scaffold(protoOutdir string, deps []ProtoDepDependency, protoDirs []string) []byte {
+	var b strings.Builder
+
+	b.WriteString("# Base output directory for vendored proto files. It is replaced by \"protodep up\".\n")
+	fmt.Fprintf(&b, "proto_outdir = %s\n", strconv.Quote(protoOutdir))
+
+	if len(protoDirs) > 0 {
+		b.WriteString("\n# Proto files of the project were found in:\n")
+		for _, dir := range protoDirs {
+			fmt.Fprintf(&b, "#   %s\n", dir)
+		}
+	}
+
+	if len(deps) == 0 {
+		b.WriteString("\n# [[dependencies]]\n")
+		b.WriteString("#   target = \"github.com/org/repo/protos\"\n")
+		b.WriteString("#   branch = \"main\"\n")
+	}
+
+	for i := range deps {
+		b.WriteString("\n")
+		b.WriteString(FormatDependency(&deps[i]))
+	}
+
+	return []byte(b.String())
+}
+
+// FindProtoDirs returns the topmost directories under root containing .proto files, relative to root.
+// Hidden directories, vendor and node_modules are skipped.
+func FindProtoDirs(root string) ([]string, error) {
+	var dirs []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			for _, dir := range dirs {
+				if Within(path, filepath.Join(root, dir)) {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+
+		if filepath.Ext(path) != ".proto" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+
+		// A subdirectory visited before a file of its parent is covered by the parent.
+		kept := dirs[:0]
+		for _, dir := range dirs {
+			if !Within(dir, rel) {
+				kept = append(kept, dir)
+			}
+		}
+		dirs = append(kept, rel)
+
+		// The rest of the directory is covered.
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range dirs {
+		dirs[i] = filepath.ToSlash(dirs[i])
+	}
+
+	return dirs, nil
+}
+
+// CheckProtoOutdir fails if proto_outdir contains one of the proto directories of the project,
+// since its content is replaced on every run.
+func CheckProtoOutdir(protoOutdir string, protoDirs []string) error {
+	outdir := filepath.Clean(protoOutdir)
+	for _, dir := range protoDirs {
+		if Within(filepath.FromSlash(dir), outdir) {
+			return fmt.Errorf("proto_outdir %s would replace the proto files of the project in %s", protoOutdir, dir)
+		}
+	}
+	return nil
+}
+
+// Create writes a new protodep.toml. An existing file is only replaced if force is set.
+func (d *Dependency) Create(content []byte, force bool) error {
+	if _, err := Parse(content); err != nil {
+		return err
+	}
+
+	if !force {
+		if _, err := os.Stat(d.tomlPath); err == nil {
+			return fmt.Errorf("%s: %w", d.tomlPath, os.ErrExist)
+		}
+	}
+
+	if err := os.WriteFile(d.tomlPath, content, 0o644); err != nil { //nolint:gosec,gomnd
+		return fmt.Errorf("write %s: %w", d.tomlPath, err)
+	}
+
+	return nil
+}
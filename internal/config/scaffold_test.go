@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDependencySpec(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected ProtoDepDependency
+	}{
+		{"github.com/org/repo", ProtoDepDependency{Target: "github.com/org/repo"}},
+		{"github.com/org/repo@main", ProtoDepDependency{Target: "github.com/org/repo", Branch: "main"}},
+		{"github.com/org/repo@v1.2.0", ProtoDepDependency{Target: "github.com/org/repo", Revision: "v1.2.0"}},
+		{"github.com/org/repo@1a2b3c4", ProtoDepDependency{Target: "github.com/org/repo", Revision: "1a2b3c4"}},
+		{"github.com/org/repo@^1.4", ProtoDepDependency{Target: "github.com/org/repo", Version: "^1.4"}},
+		{"github.com/org/repo@>=2.0.0, <3.0.0", ProtoDepDependency{Target: "github.com/org/repo", Version: ">=2.0.0, <3.0.0"}},
+	}
+
+	for _, c := range cases {
+		dep, err := ParseDependencySpec(c.spec)
+		require.NoError(t, err, c.spec)
+		require.Equal(t, c.expected, dep, c.spec)
+	}
+
+	_, err := ParseDependencySpec("@main")
+	require.Error(t, err)
+
+	_, err = ParseDependencySpec("github.com/org/repo@>=one")
+	require.Error(t, err)
+}
+
+func TestScaffold(t *testing.T) {
+	deps := []ProtoDepDependency{
+		{Target: "github.com/org/repo", Version: "^1.4"},
+		{Target: "github.com/org/other/protos", Branch: "main", Path: "other", Includes: []string{"a.proto", "b.proto"}},
+	}
+
+	conf, err := Parse(Scaffold("./third_party/proto", deps, []string{"api"}))
+	require.NoError(t, err)
+	require.Equal(t, "./third_party/proto", conf.ProtoOutdir)
+	require.Equal(t, deps, conf.Dependencies)
+
+	conf, err = Parse(Scaffold(DefaultProtoOutdir, nil, nil))
+	require.NoError(t, err)
+	require.Empty(t, conf.Dependencies)
+}
+
+func TestFindProtoDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"api/a.proto",
+		"api/v1/b.proto",
+		"proto/z/c.proto",
+		".cache/d.proto",
+		"vendor/e.proto",
+		"docs/readme.md",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	dirs, err := FindProtoDirs(root)
+	require.NoError(t, err)
+	require.Equal(t, []string{"api", "proto/z"}, dirs)
+
+	require.Error(t, CheckProtoOutdir("./proto", dirs))
+	require.NoError(t, CheckProtoOutdir("./third_party/proto", dirs))
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	dep := NewDependency(dir)
+	content := Scaffold(DefaultProtoOutdir, nil, nil)
+
+	require.NoError(t, dep.Create(content, false))
+	require.ErrorIs(t, dep.Create(content, false), os.ErrExist)
+	require.NoError(t, dep.Create(content, true))
+}
@@ -2,7 +2,12 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
 	"strings"
+
+	"github.com/Masterminds/semver/v3"
 )
 
 type ProtoDep struct {
@@ -10,28 +15,220 @@ type ProtoDep struct {
 	Dependencies []ProtoDepDependency `toml:"dependencies"`
 }
 
+// Values of ProtoDepDependency.OnConflict.
+const (
+	// OnConflictPrefer makes the files of the dependency win over files of other dependencies with the same destination.
+	OnConflictPrefer = "prefer"
+	// OnConflictIdentical allows other dependencies to write the same destination if the content is byte-identical.
+	OnConflictIdentical = "identical"
+)
+
+// applyURLs derives the target of the dependencies given by url, so that they are handled like the others.
+// A relative path of a local repository is relative to dir, unless dir is empty.
+func (d *ProtoDep) applyURLs(dir string) error {
+	for i := range d.Dependencies {
+		dep := &d.Dependencies[i]
+		if dep.URL == "" {
+			if dep.Subdir != "" {
+				return fmt.Errorf("%s: subdir can only be set together with url", dep.DisplayName())
+			}
+			continue
+		}
+
+		if dep.Target != "" || dep.LocalFolder != "" || dep.Subgroup != "" || dep.Protocol != "" {
+			return fmt.Errorf("%s: url cannot be set together with target, local_folder, subgroup or protocol", dep.URL)
+		}
+
+		u, err := ParseRepositoryURL(dep.URL)
+		if err != nil {
+			return err
+		}
+		if u.IsLocal() && dir != "" {
+			dep.localPath = ResolveLocalURL(dep.URL, dir)
+			if u, err = ParseRepositoryURL(dep.localPath); err != nil {
+				return err
+			}
+		}
+
+		if !Inside(u.CachePath()) {
+			return fmt.Errorf("%s: invalid url, the cache path %s is outside the cache directory", dep.URL, u.CachePath())
+		}
+		dep.Target = u.CachePath()
+		if dep.Subdir != "" {
+			subdir := path.Clean(filepath.ToSlash(dep.Subdir))
+			if !Inside(subdir) {
+				return fmt.Errorf("%s: subdir %s must be inside the repository", dep.URL, dep.Subdir)
+			}
+			if subdir != "." {
+				dep.Target += "/" + subdir
+			}
+		}
+	}
+
+	return nil
+}
+
 func (d *ProtoDep) Validate() error {
 	if strings.TrimSpace(d.ProtoOutdir) == "" {
 		return errors.New("required 'proto_outdir'")
 	}
+
+	names := make(map[string]bool, len(d.Dependencies))
+	for _, dep := range d.Dependencies {
+		if dep.Name != "" {
+			if names[dep.Name] {
+				return fmt.Errorf("duplicate dependency name '%s'", dep.Name)
+			}
+			names[dep.Name] = true
+		}
+
+		if dep.Version != "" {
+			if dep.Revision != "" || dep.Branch != "" {
+				return fmt.Errorf("%s: version cannot be set together with revision or branch", dep.DisplayName())
+			}
+			if _, err := dep.VersionConstraint(); err != nil {
+				return fmt.Errorf("%s: %w", dep.DisplayName(), err)
+			}
+		}
+
+		dirs := []string{path.Clean(dep.Directory())}
+		for _, p := range dep.ExtraPaths {
+			clean := path.Clean(filepath.ToSlash(p))
+			if !Inside(clean) {
+				return fmt.Errorf("%s: extra path %s must be inside the repository", dep.DisplayName(), p)
+			}
+			// The files of overlapping directories would be vendored twice.
+			for i, dir := range dirs {
+				switch {
+				case dep.Target == "" || !overlaps(clean, dir):
+				case i == 0:
+					return fmt.Errorf("%s: extra path %s overlaps the target directory %s", dep.DisplayName(), p, dir)
+				default:
+					return fmt.Errorf("%s: extra path %s overlaps %s", dep.DisplayName(), p, dir)
+				}
+			}
+			dirs = append(dirs, clean)
+		}
+
+		if dep.Depth < 0 {
+			return fmt.Errorf("%s: depth cannot be negative", dep.DisplayName())
+		}
+
+		switch dep.OnConflict {
+		case "", OnConflictPrefer, OnConflictIdentical:
+		default:
+			return fmt.Errorf("%s: invalid on_conflict '%s', expected '%s' or '%s'",
+				dep.DisplayName(), dep.OnConflict, OnConflictPrefer, OnConflictIdentical)
+		}
+	}
+
 	return nil
 }
 
+// overlaps reports whether one of the directories, relative to the repository root, contains the other.
+func overlaps(a, b string) bool {
+	return a == "." || b == "." || a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
 type ProtoDepDependency struct {
-	Target      string   `toml:"target"`
-	LocalFolder string   `toml:"local_folder"`
-	Subgroup    string   `toml:"subgroup"`
-	Revision    string   `toml:"revision"`
-	Branch      string   `toml:"branch"`
+	// Name optionally identifies the dependency in logs and commands. It must be unique within protodep.toml.
+	Name   string `toml:"name"`
+	Target string `toml:"target"`
+	// URL is the git URL of the repository, for repositories a target can't express, e.g. with a custom port.
+	// The target is derived from it and Subdir.
+	URL string `toml:"url"`
+	// Subdir is the directory of the repository given by URL the files are read from. The default is the root.
+	Subdir      string `toml:"subdir"`
+	LocalFolder string `toml:"local_folder"`
+	Subgroup    string `toml:"subgroup"`
+	Revision    string `toml:"revision"`
+	Branch      string `toml:"branch"`
+	// Version is a semantic version constraint, e.g. "^1.4" or ">=2.0.0, <3.0.0".
+	// The highest matching tag of the remote is used.
+	Version     string   `toml:"version"`
 	Path        string   `toml:"path"`
 	Ignores     []string `toml:"ignores"`
 	Includes    []string `toml:"includes"`
 	Protocol    string   `toml:"protocol"`
 	UsernameEnv string   `toml:"username_env"`
 	PasswordEnv string   `toml:"password_env"`
+	// OnConflict controls what happens if another dependency writes a file with the same destination.
+	// By default such a collision is an error.
+	OnConflict string `toml:"on_conflict"`
+	// ResolveImports adds the files imported by the selected files, transitively, if the dependency contains them.
+	ResolveImports bool `toml:"resolve_imports"`
+	// SkipTransitive disables resolving the protodep.toml found in the dependency repository.
+	SkipTransitive bool `toml:"skip_transitive"`
+	// ExtraPaths are directories of the repository, relative to its root, read in addition to the target directory.
+	// Their files are vendored with the path relative to the repository root.
+	ExtraPaths []string `toml:"extra_paths"`
+	// Depth is the number of commits fetched from the tip of the branch or tag. The default is 1.
+	// A cache missing a pinned commit is deepened automatically.
+	Depth int `toml:"depth"`
+	// Submodules makes the files of the git submodules part of the repository, recursively.
+	// Each submodule is fetched at the commit recorded in the repository.
+	Submodules bool `toml:"submodules"`
+
+	// localPath is the path of a local repository given by URL, resolved against the directory of protodep.toml.
+	localPath string
+}
+
+// CloneURL is the url the repository of a dependency given by URL is fetched from. A local repository is given
+// by its path, a relative one is resolved against the directory of protodep.toml.
+func (d *ProtoDepDependency) CloneURL() string {
+	if d.localPath != "" {
+		return d.localPath
+	}
+	return d.URL
+}
+
+// DisplayName is the name of the dependency if set, otherwise its target or local folder.
+func (d *ProtoDepDependency) DisplayName() string {
+	switch {
+	case d.Name != "":
+		return d.Name
+	case d.Target != "":
+		return d.Target
+	default:
+		return d.LocalFolder
+	}
+}
+
+// Is reports whether the dependency is referred to by name, which is its name, target or local folder.
+func (d *ProtoDepDependency) Is(name string) bool {
+	return name != "" && (name == d.Name || name == d.Target || name == d.LocalFolder)
+}
+
+// VersionConstraint parses Version.
+func (d *ProtoDepDependency) VersionConstraint() (*semver.Constraints, error) {
+	c, err := semver.NewConstraint(d.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version '%s': %w", d.Version, err)
+	}
+	return c, nil
+}
+
+// Requirement describes what the dependency is resolved to, e.g. "version ^1.4" or "branch main".
+func (d *ProtoDepDependency) Requirement() string {
+	switch {
+	case d.Version != "":
+		return "version " + d.Version
+	case d.Revision != "":
+		return "revision " + d.Revision
+	case d.Branch != "":
+		return "branch " + d.Branch
+	default:
+		return "the default branch"
+	}
 }
 
 func (d *ProtoDepDependency) Repository() string {
+	if d.URL != "" {
+		if u, err := ParseRepositoryURL(d.CloneURL()); err == nil {
+			return u.CachePath()
+		}
+	}
+
 	tokens := strings.Split(d.Target, "/")
 	subgroupTokens := make([]string, 0)
 	if d.Subgroup != "" {
@@ -46,6 +243,13 @@ func (d *ProtoDepDependency) Repository() string {
 }
 
 func (d *ProtoDepDependency) Directory() string {
+	if d.URL != "" {
+		if subdir := path.Clean(filepath.ToSlash(d.Subdir)); subdir != "." {
+			return "./" + subdir
+		}
+		return "."
+	}
+
 	r := d.Repository()
 
 	if d.Target == r {
@@ -56,6 +260,12 @@ func (d *ProtoDepDependency) Directory() string {
 }
 
 func (d *ProtoDepDependency) Machine() string {
+	if d.URL != "" {
+		if u, err := ParseRepositoryURL(d.URL); err == nil {
+			return u.Host
+		}
+	}
+
 	tokens := strings.Split(d.Target, "/")
 	if len(tokens) < 1 {
 		return ""
@@ -32,3 +32,92 @@ func TestDirectory(t *testing.T) {
 
 	require.Equal(t, "./examples", protruded.Directory())
 }
+
+func TestValidateOnConflict(t *testing.T) {
+	conf := ProtoDep{
+		ProtoOutdir:  "./proto",
+		Dependencies: []ProtoDepDependency{{Target: "github.com/google/protobuf", OnConflict: OnConflictPrefer}},
+	}
+	require.NoError(t, conf.Validate())
+
+	conf.Dependencies[0].OnConflict = "overwrite"
+	require.EqualError(t, conf.Validate(), "github.com/google/protobuf: invalid on_conflict 'overwrite', expected 'prefer' or 'identical'")
+}
+
+func TestValidateVersion(t *testing.T) {
+	conf := ProtoDep{
+		ProtoOutdir:  "./proto",
+		Dependencies: []ProtoDepDependency{{Target: "github.com/google/protobuf", Version: ">=2.0.0, <3.0.0"}},
+	}
+	require.NoError(t, conf.Validate())
+
+	conf.Dependencies[0].Revision = "v2.0.0"
+	require.EqualError(t, conf.Validate(), "github.com/google/protobuf: version cannot be set together with revision or branch")
+
+	conf.Dependencies[0].Revision = ""
+	conf.Dependencies[0].Version = "latest"
+	require.ErrorContains(t, conf.Validate(), "github.com/google/protobuf: invalid version 'latest'")
+
+	conf.Dependencies[0].Name = "protobuf"
+	require.ErrorContains(t, conf.Validate(), "protobuf: invalid version 'latest'")
+}
+
+func TestValidateName(t *testing.T) {
+	conf := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Name: "foo", Target: "github.com/org/repo", Path: "foo"},
+			{Name: "bar", Target: "github.com/org/repo", Path: "bar"},
+			{Target: "github.com/org/other"},
+		},
+	}
+	require.NoError(t, conf.Validate())
+
+	conf.Dependencies[1].Name = "foo"
+	require.Error(t, conf.Validate())
+}
+
+func TestDisplayName(t *testing.T) {
+	named := ProtoDepDependency{Name: "foo", Target: "github.com/org/repo"}
+	require.Equal(t, "foo", named.DisplayName())
+	require.True(t, named.Is("foo"))
+	require.True(t, named.Is("github.com/org/repo"))
+	require.False(t, named.Is(""))
+
+	remote := ProtoDepDependency{Target: "github.com/org/repo"}
+	require.Equal(t, "github.com/org/repo", remote.DisplayName())
+
+	local := ProtoDepDependency{LocalFolder: "./api"}
+	require.Equal(t, "./api", local.DisplayName())
+	require.True(t, local.Is("./api"))
+}
+
+func TestRequirement(t *testing.T) {
+	require.Equal(t, "version ^1.4", (&ProtoDepDependency{Version: "^1.4"}).Requirement())
+	require.Equal(t, "revision v1.0.0", (&ProtoDepDependency{Revision: "v1.0.0", Branch: "main"}).Requirement())
+	require.Equal(t, "branch main", (&ProtoDepDependency{Branch: "main"}).Requirement())
+	require.Equal(t, "the default branch", (&ProtoDepDependency{}).Requirement())
+}
+
+func TestValidateExtraPaths(t *testing.T) {
+	conf := ProtoDep{
+		ProtoOutdir:  "./proto",
+		Dependencies: []ProtoDepDependency{{Target: "github.com/org/repo/src", ExtraPaths: []string{"third_party/foo"}}},
+	}
+	require.NoError(t, conf.Validate())
+
+	conf.Dependencies[0].ExtraPaths = []string{"../outside"}
+	require.Error(t, conf.Validate())
+
+	conf.Dependencies[0].ExtraPaths = []string{"/abs"}
+	require.Error(t, conf.Validate())
+
+	// Overlapping directories would vendor the same files twice.
+	conf.Dependencies[0].ExtraPaths = []string{"src/internal"}
+	require.ErrorContains(t, conf.Validate(), "extra path src/internal overlaps the target directory src")
+	conf.Dependencies[0].ExtraPaths = []string{"third_party", "third_party/foo"}
+	require.ErrorContains(t, conf.Validate(), "extra path third_party/foo overlaps third_party")
+	conf.Dependencies[0].Target = "github.com/org/repo"
+	conf.Dependencies[0].ExtraPaths = []string{"third_party/foo"}
+	require.ErrorContains(t, conf.Validate(), "extra path third_party/foo overlaps the target directory .")
+}
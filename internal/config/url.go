@@ -0,0 +1,155 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RepositoryURL is a parsed git URL: scp-like ([user@]host:path), ssh://, git://, http://, https://, file:// or
+// a path to a local repository.
+type RepositoryURL struct {
+	// Scheme is "ssh" for scp-like URLs.
+	Scheme string
+	// User is the user of the URL, e.g. git of git@github.com:org/repo.git. It is empty if not given.
+	User string
+	Host string
+	// Port is empty for the default port of the scheme.
+	Port string
+	// Path has no leading slash and no .git suffix. A relative local path is kept relative.
+	Path string
+}
+
+// localHashLen is the number of bytes of the hash of a local path used in its cache path.
+const localHashLen = 8
+
+var defaultPorts = map[string]string{
+	"ssh":   "22",
+	"git":   "9418",
+	"http":  "80",
+	"https": "443",
+}
+
+// ParseRepositoryURL parses the url of a dependency.
+func ParseRepositoryURL(raw string) (*RepositoryURL, error) {
+	var u RepositoryURL
+
+	if isLocalPath(raw) {
+		p := strings.TrimSuffix(path.Clean(filepath.ToSlash(raw)), ".git")
+		if p == "/" || p == "." || path.Base(p) == ".." {
+			return nil, fmt.Errorf("invalid url '%s', repository path is missing", raw)
+		}
+		return &RepositoryURL{Scheme: "file", Path: strings.TrimPrefix(p, "/")}, nil
+	}
+
+	if parsed, err := url.Parse(raw); err == nil && parsed.Scheme != "" && (parsed.Host != "" || parsed.Scheme == "file") {
+		u = RepositoryURL{Scheme: strings.ToLower(parsed.Scheme), Host: parsed.Hostname(), Port: parsed.Port(), Path: parsed.Path}
+		if parsed.User != nil {
+			u.User = parsed.User.Username()
+		}
+	} else if host, p, ok := strings.Cut(raw, ":"); ok && host != "" && !strings.Contains(host, "/") && !strings.HasPrefix(p, "//") {
+		var user string
+		if usr, h, found := strings.Cut(host, "@"); found {
+			user, host = usr, h
+		}
+		u = RepositoryURL{Scheme: "ssh", User: user, Host: host, Path: p}
+	} else {
+		return nil, fmt.Errorf("invalid url '%s', expected [user@]host:path, ssh://, https:// or file://", raw)
+	}
+
+	switch u.Scheme {
+	case "ssh", "git", "http", "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid url '%s', host is missing", raw)
+		}
+		// The host is the first directory of the cache path.
+		if u.Host == "." || u.Host == ".." || strings.ContainsAny(u.Host, `/\`) {
+			return nil, fmt.Errorf("invalid url '%s', invalid host %s", raw, u.Host)
+		}
+	case "file":
+	default:
+		return nil, fmt.Errorf("invalid url '%s', unsupported scheme %s", raw, u.Scheme)
+	}
+
+	if u.Port == defaultPorts[u.Scheme] {
+		u.Port = ""
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(strings.Trim(path.Clean("/"+u.Path), "/"), ".git")
+	if u.Path == "" {
+		return nil, fmt.Errorf("invalid url '%s', repository path is missing", raw)
+	}
+
+	return &u, nil
+}
+
+// ResolveLocalURL returns the absolute path of a local repository given by a path or a file:// URL, a relative path
+// is relative to dir. Other URLs are returned unchanged.
+func ResolveLocalURL(raw, dir string) string {
+	if isLocalPath(raw) {
+		if filepath.IsAbs(raw) {
+			return filepath.Clean(raw)
+		}
+		return filepath.Join(dir, raw)
+	}
+	if parsed, err := url.Parse(raw); err == nil && strings.EqualFold(parsed.Scheme, "file") {
+		return filepath.FromSlash(parsed.Path)
+	}
+	return raw
+}
+
+// isLocalPath reports whether raw is a filesystem path rather than a URL: absolute, or relative starting with . or ..
+func isLocalPath(raw string) bool {
+	if filepath.IsAbs(raw) {
+		return true
+	}
+	slashed := filepath.ToSlash(raw)
+	return slashed == "." || slashed == ".." || strings.HasPrefix(slashed, "./") || strings.HasPrefix(slashed, "../")
+}
+
+// IsLocal reports whether the repository is on the filesystem, given by a file:// URL or a path.
+func (u *RepositoryURL) IsLocal() bool {
+	return u.Scheme == "file"
+}
+
+// CachePath is the path of the repository in the cache, e.g. host/scm/team/repo or host_7999/scm/team/repo.
+// URLs differing only in the protocol, the user, a default port or the .git suffix share the cache.
+// A local repository is cached under a hash of its path, e.g. file/1f2e3d4c5b6a7988/repo.
+func (u *RepositoryURL) CachePath() string {
+	if u.Scheme == "file" {
+		sum := sha256.Sum256([]byte(u.Path))
+		return "file/" + hex.EncodeToString(sum[:localHashLen]) + "/" + strings.ReplaceAll(path.Base(u.Path), ":", "")
+	}
+
+	host := u.Host
+	if u.Port != "" {
+		host += "_" + u.Port
+	}
+	return host + "/" + strings.ReplaceAll(u.Path, ":", "")
+}
+
+// Canonical is the URL of a remote repository without the protocol, the user, a default port and the .git suffix,
+// e.g. bitbucket.company.org:7999/scm/team/repo.
+func (u *RepositoryURL) Canonical() string {
+	host := u.Host
+	if u.Port != "" {
+		host += ":" + u.Port
+	}
+	return host + "/" + u.Path
+}
+
+// Protocol is the protocol of the url as in the protocol field, "ssh" or "https", and empty for other schemes.
+func (u *RepositoryURL) Protocol() string {
+	switch u.Scheme {
+	case "ssh":
+		return "ssh"
+	case "http", "https":
+		return "https"
+	default:
+		return ""
+	}
+}
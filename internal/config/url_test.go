@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepositoryURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		cachePath string
+		protocol  string
+		host      string
+	}{
+		{"ssh://git@bitbucket.example.com:7999/scm/team/repo.git", "bitbucket.example.com_7999/scm/team/repo", "ssh", "bitbucket.example.com"},
+		{"ssh://git@GitHub.com:22/org/repo.git", "github.com/org/repo", "ssh", "github.com"},
+		{"git@github.com:org/repo.git", "github.com/org/repo", "ssh", "github.com"},
+		{"gerrit.example.com:team/sub/repo", "gerrit.example.com/team/sub/repo", "ssh", "gerrit.example.com"},
+		{"https://gitlab.example.com/group/sub/repo.git/", "gitlab.example.com/group/sub/repo", "https", "gitlab.example.com"},
+		{"https://gitlab.example.com:8443/group/repo", "gitlab.example.com_8443/group/repo", "https", "gitlab.example.com"},
+		{"git://example.com/repo", "example.com/repo", "", "example.com"},
+		{"file:///srv/git/repo.git", "file/2aa8b6a9bfc1f987/repo", "", ""},
+		{"/srv/git/repo.git", "file/2aa8b6a9bfc1f987/repo", "", ""},
+		{"./fixtures/repo", "file/126fc19dd51e1f79/repo", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := ParseRepositoryURL(tt.url)
+			require.NoError(t, err)
+			require.Equal(t, tt.cachePath, u.CachePath())
+			require.Equal(t, tt.protocol, u.Protocol())
+			require.Equal(t, tt.host, u.Host)
+		})
+	}
+
+	for url, user := range map[string]string{
+		"ssh://alice@gerrit.example.com:29418/project": "alice",
+		"alice@gerrit.example.com:project":             "alice",
+		"https://gitlab.example.com/group/repo":        "",
+	} {
+		u, err := ParseRepositoryURL(url)
+		require.NoError(t, err)
+		require.Equal(t, user, u.User, url)
+	}
+
+	for _, invalid := range []string{"", "repo", "/", ".", "../..", "ftp://example.com/repo", "https://example.com", "ssh:///repo",
+		"ssh://../repo", "..:repo", "git@..:repo", "https://../../x/y", `host\sub:repo`,
+	} {
+		_, err := ParseRepositoryURL(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestParseURLDependency(t *testing.T) {
+	conf, err := Parse([]byte(`
+proto_outdir = "./proto"
+
+[[dependencies]]
+  url = "ssh://git@bitbucket.example.com:7999/scm/team/repo.git"
+  subdir = "api/proto"
+  branch = "main"
+`))
+	require.NoError(t, err)
+
+	dep := conf.Dependencies[0]
+	require.Equal(t, "bitbucket.example.com_7999/scm/team/repo/api/proto", dep.Target)
+	require.Equal(t, "bitbucket.example.com_7999/scm/team/repo", dep.Repository())
+	require.Equal(t, "./api/proto", dep.Directory())
+	require.Equal(t, "bitbucket.example.com", dep.Machine())
+
+	for _, invalid := range []string{
+		`url = "git@github.com:org/repo.git"` + "\n" + `target = "github.com/org/repo"`,
+		`url = "git@github.com:org/repo.git"` + "\n" + `protocol = "https"`,
+		`url = "git@github.com:org/repo.git"` + "\n" + `subdir = "../outside"`,
+		`url = "ftp://example.com/repo"`,
+		`url = "https://../../x/y"`,
+		`target = "github.com/org/repo"` + "\n" + `subdir = "proto"`,
+	} {
+		_, err := Parse([]byte("proto_outdir = \"./proto\"\n[[dependencies]]\n" + invalid))
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestLoadRelativeLocalURL(t *testing.T) {
+	root := t.TempDir()
+	for _, project := range []string{"a", "b"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, project), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(root, project, FileName), []byte(`
+proto_outdir = "./proto"
+
+[[dependencies]]
+  url = "../../../src/repo"
+`), 0o644))
+	}
+
+	a, err := NewDependency(filepath.Join(root, "a")).Load()
+	require.NoError(t, err)
+	b, err := NewDependency(filepath.Join(root, "b")).Load()
+	require.NoError(t, err)
+
+	dep := a.Dependencies[0]
+	require.Equal(t, filepath.Join(root, "a", "../../../src/repo"), dep.CloneURL())
+	// The cache path stays inside the cache directory and is derived from the resolved path.
+	require.True(t, filepath.IsLocal(filepath.FromSlash(dep.Repository())), dep.Repository())
+	require.Equal(t, dep.Target, dep.Repository())
+	require.Equal(t, b.Dependencies[0].Target, dep.Target)
+}
+
+func TestResolveLocalURL(t *testing.T) {
+	require.Equal(t, "/project/fixtures/repo", ResolveLocalURL("./fixtures/repo", "/project"))
+	require.Equal(t, "/mirror/repo", ResolveLocalURL("../mirror/repo", "/project"))
+	require.Equal(t, "/srv/git/repo.git", ResolveLocalURL("/srv/git/repo.git", "/project"))
+	require.Equal(t, "/srv/git/repo.git", ResolveLocalURL("file:///srv/git/repo.git", "/project"))
+	require.Equal(t, "git@github.com:org/repo.git", ResolveLocalURL("git@github.com:org/repo.git", "/project"))
+}
@@ -3,6 +3,7 @@ package logger
 import (
 	"fmt"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/mattn/go-isatty"
@@ -23,8 +24,22 @@ func Error(format string, a ...any) {
 	color.Red("[ERROR] "+format, a...)
 }
 
+// UseStderr sends the log to stderr, keeping stdout for the command output.
+func UseStderr() {
+	color.Output = color.Error
+}
+
+var spinnerDisabled atomic.Bool
+
+// DisableSpinner turns off the progress spinner, e.g. when several operations log at the same time.
+func DisableSpinner() {
+	spinnerDisabled.Store(true)
+}
+
 type spinnerWrapper struct {
 	spinner *spinner.Spinner
+	// lineDone is set when the message was printed with a line break already.
+	lineDone bool
 }
 
 func (s *spinnerWrapper) Stop() {
@@ -37,19 +52,26 @@ func (s *spinnerWrapper) Finish() {
 	if s.spinner != nil {
 		s.spinner.Stop()
 	}
-	fmt.Print("\n")
+	if !s.lineDone {
+		fmt.Fprint(color.Output, "\n")
+	}
 }
 
 func InfoWithSpinner(format string, a ...any) *spinnerWrapper {
+	if spinnerDisabled.Load() {
+		Info(format, a...)
+		return &spinnerWrapper{lineDone: true}
+	}
+
 	txt := color.GreenString("[INFO] "+format, a...)
-	fmt.Print(txt)
+	fmt.Fprint(color.Output, txt)
 
 	var s *spinner.Spinner
 	if isatty.IsTerminal(os.Stdout.Fd()) {
-		fmt.Print("\n")
+		fmt.Fprint(color.Output, "\n")
 		s = spinner.New(spinner.CharSets[38], 100*time.Millisecond) //nolint:gomnd // Build our new spinner
 		s.Start()
 	}
 
-	return &spinnerWrapper{s}
+	return &spinnerWrapper{spinner: s}
 }
@@ -1,24 +1,83 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 
 	"github.com/n-r-w/protodep/internal/auth"
+	"github.com/n-r-w/protodep/internal/cache"
 	"github.com/n-r-w/protodep/internal/config"
 	"github.com/n-r-w/protodep/internal/logger"
 )
 
-const masterBranch = "master"
+const (
+	remoteBranchPrefix = "refs/remotes/origin/"
+	// remoteHead is the default branch of the remote, kept in the cache for resolving it offline.
+	remoteHead plumbing.ReferenceName = "refs/remotes/origin/HEAD"
+	// commitRefPrefix keeps commits fetched by hash referenced in the cache.
+	commitRefPrefix = "refs/protodep/commits/"
+
+	// defaultDepth is used when the dependency doesn't set depth.
+	defaultDepth = 1
+	// fullDepth deepens a shallow cache to the whole history.
+	fullDepth = math.MaxInt32
+
+	allBranches gitconfig.RefSpec = "+refs/heads/*:refs/remotes/origin/*"
+	allTags     gitconfig.RefSpec = "+refs/tags/*:refs/tags/*"
+)
+
+// Mode controls whether the cached repositories are fetched from their remotes.
+type Mode int
+
+const (
+	// ModeOnline fetches every dependency.
+	ModeOnline Mode = iota
+	// ModePreferOffline fetches, but resolves from the cache with a warning if the remote can't be reached.
+	ModePreferOffline
+	// ModeOffline never contacts a remote and resolves branches and tags from the cached references.
+	ModeOffline
+)
+
+var (
+	// ErrNotCached is returned when a repository, reference or commit is missing in the cache and can't be fetched.
+	ErrNotCached = errors.New("not cached")
+	// ErrOffline is returned by operations that need the remote in offline mode.
+	ErrOffline = errors.New("the remote can't be contacted in offline mode")
+)
+
+// remoteError is a failure to talk to the remote, as opposed to an error of the cache or of the requirement.
+type remoteError struct {
+	err error
+}
+
+func (e *remoteError) Error() string {
+	return e.err.Error()
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
 
 type Git struct {
 	protodepDir  string
 	dep          config.ProtoDepDependency
 	authProvider auth.AuthProvider
+	skipFetch    bool
+	lockTimeout  time.Duration
+	mode         Mode
 }
 
 func NewGit(protodepDir string, dep config.ProtoDepDependency, authProvider auth.AuthProvider) *Git {
@@ -29,150 +88,546 @@ func NewGit(protodepDir string, dep config.ProtoDepDependency, authProvider auth
 	}
 }
 
+// ForDependency returns a copy resolving another requirement of the same repository, with the same credentials.
+func (r *Git) ForDependency(dep config.ProtoDepDependency) *Git {
+	c := *r
+	c.dep = dep
+	return &c
+}
+
+// SkipFetch makes Open use the cached repository as is. The repository is still cloned if it isn't cached.
+func (r *Git) SkipFetch() {
+	r.skipFetch = true
+}
+
+// SetMode sets whether Open and OpenCommit may fetch from the remote.
+func (r *Git) SetMode(mode Mode) {
+	r.mode = mode
+}
+
+// SetLockTimeout sets how long Open waits for other processes using the cached repository.
+func (r *Git) SetLockTimeout(timeout time.Duration) {
+	r.lockTimeout = timeout
+}
+
+// OpenedRepository is a resolved commit of the cached repository. Files are read from the git objects of the commit.
 type OpenedRepository struct {
 	Repository *git.Repository
 	Dep        config.ProtoDepDependency
 	Hash       string
+	// Ref is the reference Hash was resolved from. It is empty when the dependency points to a commit.
+	Ref string
+	URL string
+	// Fetched is true if the remote was contacted.
+	Fetched bool
+
+	commit *object.Commit
+	// lock keeps other processes from changing the cached repository while its objects are read.
+	lock *cache.Lock
 }
 
-func (r *Git) Open() (*OpenedRepository, error) {
-	branch := masterBranch
-	if r.dep.Branch != "" {
-		branch = r.dep.Branch
+// Close releases the lock of the cached repository. Files of the commit must not be read afterwards.
+func (o *OpenedRepository) Close() {
+	if o.lock != nil {
+		o.lock.Unlock()
+		o.lock = nil
 	}
+}
 
-	revision := r.dep.Revision
+// Open fetches the branch, tag or commit of the dependency into the cache and resolves it.
+// Only the requested reference is fetched, with the history limited to the depth of the dependency.
+// In offline mode, or if the remote can't be reached in prefer-offline mode, it is resolved from the cached references.
+// The cached repository stays locked until the returned repository is closed.
+func (r *Git) Open(ctx context.Context) (*OpenedRepository, error) {
+	return r.locked(ctx, r.open)
+}
+
+// OpenCommit opens a commit pinned by protodep.lock. The repository is fetched only if the commit is missing in the cache.
+// The cached repository stays locked until the returned repository is closed.
+func (r *Git) OpenCommit(ctx context.Context, commit, ref string) (*OpenedRepository, error) {
+	return r.locked(ctx, func(ctx context.Context) (*OpenedRepository, error) {
+		return r.openCommit(ctx, commit, ref)
+	})
+}
 
-	reponame := r.dep.Repository()
-	repopath := filepath.Join(r.protodepDir, reponame)
+// OpenCommitLocked opens a commit like OpenCommit, of the cached repository that held already locked, e.g. another
+// commit of the same submodule. Closing the returned repository doesn't release the lock.
+func (r *Git) OpenCommitLocked(ctx context.Context, held *OpenedRepository, commit, ref string) (*OpenedRepository, error) {
+	if held.lock == nil || held.Dep.Repository() != r.Repository() {
+		return nil, fmt.Errorf("%s is not locked", r.Repository())
+	}
+	return r.openCommit(ctx, commit, ref)
+}
 
-	authMethod, err := r.authProvider.AuthMethod()
+// locked runs open with the cached repository locked. The lock is handed over to the opened repository.
+func (r *Git) locked(ctx context.Context, open func(context.Context) (*OpenedRepository, error)) (*OpenedRepository, error) {
+	lock, err := cache.LockRepository(ctx, r.RootDir(), r.lockTimeout)
 	if err != nil {
 		return nil, err
 	}
 
-	var (
-		rep  *git.Repository
-		stat os.FileInfo
-	)
+	opened, err := open(ctx)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
 
-	if stat, err = os.Stat(repopath); err == nil && stat.IsDir() {
-		spinner := logger.InfoWithSpinner("Getting %s ", reponame)
+	opened.lock = lock
+	return opened, nil
+}
 
-		rep, err = git.PlainOpen(repopath)
-		if err != nil {
-			return nil, fmt.Errorf("open repository %s: %w", repopath, err)
-		}
-		spinner.Stop()
+func (r *Git) open(ctx context.Context) (*OpenedRepository, error) {
+	rep, err := r.openCache(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		fetchOpts := &git.FetchOptions{
-			Auth: authMethod,
+	fetched := false
+	cachedOnly := r.mode == ModeOffline
+	if !r.skipFetch && !cachedOnly {
+		err = r.fetchRequirement(ctx, rep)
+		var remoteErr *remoteError
+		switch {
+		case err == nil:
+			fetched = true
+		case r.mode == ModePreferOffline && errors.As(err, &remoteErr) && ctx.Err() == nil:
+			logger.Warn("%s: %v, using the cache", r.dep.DisplayName(), err)
+			cachedOnly = true
+		default:
+			return nil, err
 		}
+	}
 
-		// TODO: Validate remote setting.
-		// TODO: If .protodep cache remains with SSH, change remote target to HTTPS.
+	hash, ref, err := r.resolve(rep)
+	if cachedOnly && err == nil && !hasObject(rep, hash) {
+		err = fmt.Errorf("commit %s not found", hash)
+	}
+	if cachedOnly && err != nil {
+		return nil, fmt.Errorf("%s: %s is %w: %v", r.dep.DisplayName(), r.dep.Requirement(), ErrNotCached, err)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		if err = rep.Fetch(fetchOpts); err != nil {
-			if err != git.NoErrAlreadyUpToDate {
-				return nil, fmt.Errorf("fetch repository %s: %w", repopath, err)
-			}
+	return r.opened(rep, hash, ref, fetched)
+}
+
+// resolve finds the commit the dependency requires among the cached references.
+func (r *Git) resolve(rep *git.Repository) (plumbing.Hash, string, error) {
+	if r.dep.Version != "" {
+		tag, err := r.resolveVersion(rep)
+		if err != nil {
+			return plumbing.ZeroHash, "", err
+		}
+		target, err := rep.Reference(tag, false)
+		if err != nil {
+			return plumbing.ZeroHash, "", fmt.Errorf("tag '%s' reference: %w", tag, err)
+		}
+		hash, err := peelTag(rep, target.Hash())
+		if err != nil {
+			return plumbing.ZeroHash, "", fmt.Errorf("tag '%s' commit: %w", tag, err)
 		}
-		spinner.Finish()
+		return hash, tag.String(), nil
+	}
 
-	} else {
-		spinner := logger.InfoWithSpinner("Getting %s ", reponame)
-		url := r.authProvider.GetRepositoryURL(reponame)
-		// IDEA: Is it better to register both ssh and HTTP?
-		rep, err = git.PlainClone(repopath, false, &git.CloneOptions{
-			Auth: authMethod,
-			URL:  url,
-		})
+	revision := r.dep.Revision
+	if revision == "" {
+		branch := r.dep.Branch
+		if branch == "" {
+			head, err := rep.Storer.Reference(remoteHead)
+			if err != nil {
+				return plumbing.ZeroHash, "", fmt.Errorf("default branch: %w", err)
+			}
+			branch = strings.TrimPrefix(head.Target().String(), remoteBranchPrefix)
+			logger.Info("%s: using the default branch %s", r.dep.DisplayName(), branch)
+		}
+		target, err := r.getReference(rep, branch)
 		if err != nil {
-			return nil, fmt.Errorf("clone repository %s: %w", url, err)
+			return plumbing.ZeroHash, "", fmt.Errorf("change branch to %s: %w", branch, err)
 		}
-		spinner.Finish()
+		ref := plumbing.NewBranchReferenceName(strings.TrimPrefix(target.Name().String(), remoteBranchPrefix))
+		return target.Hash(), ref.String(), nil
 	}
 
-	wt, err := rep.Worktree()
+	tag := plumbing.NewTagReferenceName(revision)
+	target, err := rep.Reference(tag, false)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, "", fmt.Errorf("tag '%s' reference: %w", tag, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("get worktree: %w", err)
+		// Tag not found, revision must be a hash
+		logger.Info("%s: %s is not a tag, using it as a hash", r.dep.DisplayName(), revision)
+		return plumbing.NewHash(revision), "", nil
 	}
 
-	if revision == "" {
-		var target *plumbing.Reference
-		target, err = r.resolveReference(rep, branch)
+	logger.Info("%s: %s is a tag, using the tagged commit", r.dep.DisplayName(), revision)
+	hash, err := peelTag(rep, target.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("tag '%s' commit: %w", tag, err)
+	}
+	return hash, tag.String(), nil
+}
+
+// requirement describes what the dependency asks for.
+func (r *Git) openCommit(ctx context.Context, commit, ref string) (*OpenedRepository, error) {
+	hash := plumbing.NewHash(commit)
+
+	rep, err := r.openCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := false
+	if !hasObject(rep, hash) {
+		if r.mode == ModeOffline {
+			return nil, fmt.Errorf("%s: commit %s locked in protodep.lock is %w", r.dep.DisplayName(), hash, ErrNotCached)
+		}
+		if err = r.fetchCommit(ctx, rep, hash, plumbing.ReferenceName(ref)); err != nil {
+			return nil, err
+		}
+		fetched = true
+	}
+
+	return r.opened(rep, hash, ref, fetched)
+}
+
+// openCache opens the cached repository. On the first use an empty bare repository with the origin remote is created.
+// The cache is a bare object store: files are read from the commit trees, so any number of revisions can be used at once.
+// A cache whose origin differs from the current repository URL is repaired, see syncRemote.
+func (r *Git) openCache(ctx context.Context) (*git.Repository, error) {
+	repopath := r.RootDir()
+	url := r.url()
+
+	if stat, err := os.Stat(repopath); err == nil && stat.IsDir() {
+		rep, err := git.PlainOpen(repopath)
 		if err != nil {
-			return nil, fmt.Errorf("change branch to %s: %w", branch, err)
+			return nil, fmt.Errorf("open repository %s: %w", repopath, err)
+		}
+		if r.mode == ModeOffline {
+			return rep, nil
 		}
 
-		if err = wt.Checkout(&git.CheckoutOptions{Hash: target.Hash()}); err != nil {
-			return nil, fmt.Errorf("checkout revision to %s: %w", revision, err)
+		reuse, err := r.syncRemote(ctx, rep, url)
+		if err != nil {
+			return nil, err
+		}
+		if reuse {
+			return rep, nil
 		}
 
-		head := plumbing.NewHashReference(plumbing.HEAD, target.Hash())
-		if err = rep.Storer.SetReference(head); err != nil {
-			return nil, fmt.Errorf("set head to %s: %w", branch, err)
+		if err := os.RemoveAll(repopath); err != nil {
+			return nil, fmt.Errorf("remove repository %s: %w", repopath, err)
 		}
-	} else {
-		var opts git.CheckoutOptions
+	}
 
-		tag := plumbing.NewTagReferenceName(revision)
-		_, err = rep.Reference(tag, false)
-		if err != nil && err != plumbing.ErrReferenceNotFound {
-			return nil, fmt.Errorf("tag '%s' reference: %w", tag, err)
-		} else {
-			if err != nil {
-				// Tag not found, revision must be a hash
-				logger.Info("%s is not a tag, checking out by hash", revision)
-				hash := plumbing.NewHash(revision)
-				opts = git.CheckoutOptions{Hash: hash}
-			} else {
-				logger.Info("%s is a tag, checking out by tag", revision)
-				opts = git.CheckoutOptions{Branch: tag}
+	if r.mode == ModeOffline {
+		return nil, fmt.Errorf("%s: repository %s is %w", r.dep.DisplayName(), r.dep.Repository(), ErrNotCached)
+	}
+
+	rep, err := git.PlainInit(repopath, true)
+	if err != nil {
+		return nil, fmt.Errorf("create repository %s: %w", repopath, err)
+	}
+
+	if _, err = rep.CreateRemote(&gitconfig.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{url}}); err != nil {
+		return nil, fmt.Errorf("create remote %s: %w", url, err)
+	}
+
+	return rep, nil
+}
+
+// fetchRequirement looks up the branch, tag or commit of the dependency on the remote and fetches only that reference.
+// If the cache already contains the commit the reference points to, only the local reference is updated.
+func (r *Git) fetchRequirement(ctx context.Context, rep *git.Repository) error {
+	remote, err := rep.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return fmt.Errorf("remote of %s: %w", r.dep.Repository(), err)
+	}
+
+	refs, err := r.list(ctx, remote)
+	if err != nil {
+		return err
+	}
+
+	var name plumbing.ReferenceName
+	switch {
+	case r.dep.Version != "":
+		var tags []string
+		for _, ref := range refs {
+			if ref.Name().IsTag() {
+				tags = append(tags, ref.Name().Short())
+			}
+		}
+		tag, err := r.matchVersion(SortVersions(tags))
+		if err != nil {
+			return err
+		}
+		name = plumbing.NewTagReferenceName(tag)
+	case r.dep.Revision != "":
+		name = plumbing.NewTagReferenceName(r.dep.Revision)
+		if findReference(refs, name) == nil {
+			// Not a tag, so the revision is a commit.
+			if !plumbing.IsHash(r.dep.Revision) {
+				return fmt.Errorf("%s: revision %s is neither a tag nor a full commit hash", r.dep.DisplayName(), r.dep.Revision)
+			}
+			hash := plumbing.NewHash(r.dep.Revision)
+			if hasObject(rep, hash) {
+				return nil
+			}
+			return r.fetchCommit(ctx, rep, hash, "")
+		}
+	default:
+		branch := r.dep.Branch
+		if branch == "" {
+			if branch, err = DefaultBranch(refs); err != nil {
+				return fmt.Errorf("%s: %w, set branch", r.dep.DisplayName(), err)
+			}
+			head := plumbing.NewSymbolicReference(remoteHead, plumbing.ReferenceName(remoteBranchPrefix+branch))
+			if err = rep.Storer.SetReference(head); err != nil {
+				return fmt.Errorf("default branch of %s: %w", r.dep.Repository(), err)
 			}
 		}
+		name = plumbing.NewBranchReferenceName(branch)
+	}
+
+	remoteRef := findReference(refs, name)
+	if remoteRef == nil {
+		return fmt.Errorf("%s not found in %s", name, r.dep.Repository())
+	}
+
+	spec := refSpec(name)
+	if hasObject(rep, remoteRef.Hash()) {
+		return rep.Storer.SetReference(plumbing.NewHashReference(spec.Dst(name), remoteRef.Hash()))
+	}
 
-		if err = wt.Checkout(&opts); err != nil {
-			return nil, fmt.Errorf("checkout to %s: %w", revision, err)
+	return r.fetch(ctx, rep, r.depth(), spec)
+}
+
+// fetchCommit fetches a commit that is missing in the cache. The reference it was resolved from is tried first,
+// then the commit alone, which not every server allows. If the commit is still missing, for example because it is
+// older than the shallow history, the cache is deepened to the full history of all branches and tags.
+func (r *Git) fetchCommit(ctx context.Context, rep *git.Repository, hash plumbing.Hash, ref plumbing.ReferenceName) error {
+	if ref != "" {
+		if err := r.fetch(ctx, rep, r.depth(), refSpec(ref)); err != nil {
+			return err
+		}
+		if hasObject(rep, hash) {
+			return nil
 		}
 	}
 
-	commiter, err := rep.Log(&git.LogOptions{})
+	spec := gitconfig.RefSpec(hash.String() + ":" + commitRefPrefix + hash.String())
+	if err := r.fetch(ctx, rep, r.depth(), spec); err == nil && hasObject(rep, hash) {
+		return nil
+	}
+
+	logger.Info("%s: %s is not in the fetched history, deepening the cache", r.dep.DisplayName(), hash)
+	if err := r.fetch(ctx, rep, fullDepth, allBranches, allTags); err != nil {
+		return err
+	}
+	if !hasObject(rep, hash) {
+		return fmt.Errorf("commit %s not found in %s", hash, r.dep.Repository())
+	}
+
+	return nil
+}
+
+// fetch fetches the refspecs from origin. Tags are fetched only if a refspec asks for them.
+func (r *Git) fetch(ctx context.Context, rep *git.Repository, depth int, specs ...gitconfig.RefSpec) error {
+	authMethod, err := r.authMethod()
 	if err != nil {
-		return nil, fmt.Errorf("get commit: %w", err)
+		return err
+	}
+
+	spinner := logger.InfoWithSpinner("Getting %s ", r.dep.DisplayName())
+	defer spinner.Finish()
+
+	err = rep.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   specs,
+		Depth:      depth,
+		Auth:       authMethod,
+		Tags:       git.NoTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return &remoteError{fmt.Errorf("fetch repository %s: %w", r.dep.Repository(), err)}
+	}
+
+	return nil
+}
+
+// depth is the number of commits fetched from the tip of a reference.
+func (r *Git) depth() int {
+	if r.dep.Depth > 0 {
+		return r.dep.Depth
 	}
+	return defaultDepth
+}
 
-	current, err := commiter.Next()
+func (r *Git) opened(rep *git.Repository, hash plumbing.Hash, ref string, fetched bool) (*OpenedRepository, error) {
+	commit, err := rep.CommitObject(hash)
 	if err != nil {
-		return nil, fmt.Errorf("get current commit: %w", err)
+		return nil, fmt.Errorf("commit %s: %w", hash, err)
+	}
+
+	var url string
+	if remote, err := rep.Remote(git.DefaultRemoteName); err == nil && len(remote.Config().URLs) > 0 {
+		url = remote.Config().URLs[0]
 	}
 
 	return &OpenedRepository{
 		Repository: rep,
 		Dep:        r.dep,
-		Hash:       current.Hash.String(),
+		Hash:       hash.String(),
+		Ref:        ref,
+		URL:        url,
+		Fetched:    fetched,
+		commit:     commit,
 	}, nil
 }
 
-func (r *Git) ProtoRootDir() string {
-	return filepath.Join(r.protodepDir, r.dep.Target)
+// ListRemote lists the references of the remote repository without touching the cache.
+func (r *Git) ListRemote(ctx context.Context) ([]*plumbing.Reference, error) {
+	if r.mode == ModeOffline {
+		return nil, fmt.Errorf("list remote of %s: %w", r.dep.DisplayName(), ErrOffline)
+	}
+	return r.listURL(ctx, r.url())
 }
 
-func (r *Git) resolveReference(rep *git.Repository, branch string) (*plumbing.Reference, error) {
-	if branch != masterBranch {
-		return r.getReference(rep, branch)
+// authMethod is nil for local repositories, which have no auth provider.
+func (r *Git) authMethod() (transport.AuthMethod, error) {
+	if r.authProvider == nil {
+		return nil, nil
 	}
-	// If master branch is failed, try main branch.
-	target, err := r.getReference(rep, branch)
-	if err == plumbing.ErrReferenceNotFound {
-		return r.getReference(rep, "main")
+	return r.authProvider.AuthMethod()
+}
+
+// url is the url of the dependency if set, otherwise the auth provider builds it from the repository.
+func (r *Git) url() string {
+	if r.dep.URL != "" {
+		return r.dep.CloneURL()
 	}
+	return r.authProvider.GetRepositoryURL(r.dep.Repository())
+}
+
+func (r *Git) listURL(ctx context.Context, url string) ([]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	return r.list(ctx, remote)
+}
+
+func (r *Git) list(ctx context.Context, remote *git.Remote) ([]*plumbing.Reference, error) {
+	authMethod, err := r.authMethod()
 	if err != nil {
 		return nil, err
 	}
-	return target, nil
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: authMethod})
+	if err != nil {
+		return nil, &remoteError{fmt.Errorf("list remote %s: %w", remote.Config().URLs[0], err)}
+	}
+
+	return refs, nil
+}
+
+// Repository is the path of the cached repository relative to the cache directory.
+func (r *Git) Repository() string {
+	return r.dep.Repository()
+}
+
+// RootDir is the path the repository root is reported under.
+func (r *Git) RootDir() string {
+	return filepath.Join(r.protodepDir, r.Repository())
+}
+
+// ProtoRootDir is the path the files of the dependency are reported under. Since the cache is bare, nothing is stored there.
+func (r *Git) ProtoRootDir() string {
+	return filepath.Join(r.RootDir(), r.dep.Directory())
 }
 
 func (r *Git) getReference(rep *git.Repository, branch string) (*plumbing.Reference, error) {
-	return rep.Storer.Reference(plumbing.ReferenceName(fmt.Sprintf("refs/remotes/origin/%s", branch)))
+	return rep.Storer.Reference(plumbing.ReferenceName(remoteBranchPrefix + branch))
+}
+
+// resolveVersion returns the highest tag of the cache matching the version constraint of the dependency.
+func (r *Git) resolveVersion(rep *git.Repository) (plumbing.ReferenceName, error) {
+	versions, err := Versions(rep)
+	if err != nil {
+		return "", err
+	}
+
+	tag, err := r.matchVersion(versions)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Info("%s: version %s resolved to %s", r.dep.DisplayName(), r.dep.Version, tag)
+	return plumbing.NewTagReferenceName(tag), nil
+}
+
+// matchVersion returns the highest of the sorted tags matching the version constraint of the dependency.
+func (r *Git) matchVersion(versions []TagVersion) (string, error) {
+	constraint, err := r.dep.VersionConstraint()
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		if constraint.Check(versions[i].Version) {
+			return versions[i].Tag, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: no tag of %s matches version %s", r.dep.DisplayName(), r.dep.Repository(), r.dep.Version)
+}
+
+// refSpec maps a remote reference to the cache: branches are kept as remote-tracking branches, everything else as is.
+func refSpec(name plumbing.ReferenceName) gitconfig.RefSpec {
+	dst := name
+	if name.IsBranch() {
+		dst = plumbing.ReferenceName(remoteBranchPrefix + name.Short())
+	}
+	return gitconfig.RefSpec("+" + name.String() + ":" + dst.String())
+}
+
+// DefaultBranch returns the branch the HEAD of the remote points to, given the references listed from the remote.
+func DefaultBranch(refs []*plumbing.Reference) (string, error) {
+	head := findReference(refs, plumbing.HEAD)
+	if head == nil || head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", errors.New("the remote doesn't tell its default branch")
+	}
+	return head.Target().Short(), nil
+}
+
+func findReference(refs []*plumbing.Reference, name plumbing.ReferenceName) *plumbing.Reference {
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref
+		}
+	}
+	return nil
+}
+
+func hasObject(rep *git.Repository, hash plumbing.Hash) bool {
+	return rep.Storer.HasEncodedObject(hash) == nil
+}
+
+// peelTag returns the commit an annotated or lightweight tag points to.
+func peelTag(rep *git.Repository, hash plumbing.Hash) (plumbing.Hash, error) {
+	tag, err := rep.TagObject(hash)
+	if err == plumbing.ErrObjectNotFound {
+		return hash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return commit.Hash, nil
 }
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// syncRemote compares the origin of a cached repository with url, e.g. after a dependency switched from ssh to https
+// or moved to another host. If they differ and the cache holds the same repository, origin is rewritten. It returns
+// false if the cache holds an unrelated repository and has to be created again.
+func (r *Git) syncRemote(ctx context.Context, rep *git.Repository, url string) (bool, error) {
+	cfg, err := rep.Config()
+	if err != nil {
+		return false, fmt.Errorf("config of %s: %w", r.dep.Repository(), err)
+	}
+
+	remote, ok := cfg.Remotes[git.DefaultRemoteName]
+	if !ok || len(remote.URLs) == 0 {
+		logger.Info("%s: the cache has no origin, setting it to %s", r.dep.DisplayName(), url)
+	} else {
+		cached := remote.URLs[0]
+		if cached == url {
+			return true, nil
+		}
+
+		if repositoryPath(cached) != repositoryPath(url) {
+			related, err := r.isRelated(ctx, rep, url)
+			var remoteErr *remoteError
+			if err != nil && r.mode == ModePreferOffline && errors.As(err, &remoteErr) && ctx.Err() == nil {
+				logger.Warn("%s: %v, keeping the cached origin %s", r.dep.DisplayName(), err, cached)
+				return true, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			if !related {
+				logger.Info("%s: %s is unrelated to the cached %s, fetching it again", r.dep.DisplayName(), url, cached)
+				return false, nil
+			}
+		}
+
+		logger.Info("%s: changing the cached origin from %s to %s", r.dep.DisplayName(), cached, url)
+	}
+
+	cfg.Remotes[git.DefaultRemoteName] = &gitconfig.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{url}}
+	if err := rep.SetConfig(cfg); err != nil {
+		return false, fmt.Errorf("set origin of %s to %s: %w", r.dep.Repository(), url, err)
+	}
+
+	return true, nil
+}
+
+// isRelated reports whether the repository at url shares a commit with the cache, as a mirror does.
+// An empty cache is related to any repository.
+func (r *Git) isRelated(ctx context.Context, rep *git.Repository, url string) (bool, error) {
+	refs, err := rep.References()
+	if err != nil {
+		return false, fmt.Errorf("references of %s: %w", r.dep.Repository(), err)
+	}
+
+	empty := true
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			empty = false
+		}
+		return nil
+	})
+	if empty {
+		return true, nil
+	}
+
+	remoteRefs, err := r.listURL(ctx, url)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ref := range remoteRefs {
+		if ref.Type() == plumbing.HashReference && hasObject(rep, ref.Hash()) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// repositoryPath reduces a repository URL to host and path, so that URLs differing only in the protocol, the port,
+// the user or the .git suffix are equal, e.g. git@github.com:org/repo.git and https://github.com/org/repo.
+func repositoryPath(rawURL string) string {
+	u, err := config.ParseRepositoryURL(rawURL)
+	if err != nil {
+		// A local path.
+		return strings.TrimSuffix(strings.Trim(filepath.ToSlash(rawURL), "/"), ".git")
+	}
+	if u.Host == "" {
+		return u.Path
+	}
+	return u.Host + "/" + u.Path
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// Submodule is a submodule of a commit, as declared in .gitmodules and recorded in the tree.
+type Submodule struct {
+	// Path is relative to the repository root.
+	Path string
+	// URL is absolute, a relative URL of .gitmodules is resolved against the URL of the parent repository.
+	URL string
+	// Commit is the commit of the submodule recorded in the tree of the parent.
+	Commit string
+}
+
+// Submodules returns the submodules of the commit sorted by path. Submodules of .gitmodules missing in the tree are skipped.
+func (o *OpenedRepository) Submodules() ([]Submodule, error) {
+	content, err := o.ReadFile(".gitmodules")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	modules := gitconfig.NewModules()
+	if err := modules.Unmarshal(content); err != nil {
+		return nil, fmt.Errorf(".gitmodules of %s: %w", o.Hash, err)
+	}
+
+	tree, err := o.commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("tree of %s: %w", o.Hash, err)
+	}
+
+	submodules := make([]Submodule, 0, len(modules.Submodules))
+	for _, m := range modules.Submodules {
+		subPath := strings.Trim(path.Clean(m.Path), "/")
+		entry, err := tree.FindEntry(subPath)
+		if err != nil || entry.Mode != filemode.Submodule {
+			logger.Warn("%s: submodule %s of .gitmodules is not in the tree of %s", o.Dep.DisplayName(), m.Path, o.Hash)
+			continue
+		}
+
+		submodules = append(submodules, Submodule{
+			Path:   subPath,
+			URL:    submoduleURL(o.URL, m.URL),
+			Commit: entry.Hash.String(),
+		})
+	}
+
+	sort.Slice(submodules, func(i, j int) bool {
+		return submodules[i].Path < submodules[j].Path
+	})
+
+	return submodules, nil
+}
+
+// FilesWithSubmodules lists the files under dir like Files, together with the files of the submodules under dir,
+// recursively. If dir lies inside a submodule, the files are read from the submodule. open opens a submodule at
+// its recorded commit.
+func (o *OpenedRepository) FilesWithSubmodules(dir string, open func(Submodule) (*OpenedRepository, error)) ([]File, error) {
+	dir = strings.Trim(path.Clean(dir), "/")
+
+	submodules, err := o.Submodules()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range submodules {
+		if !config.Within(dir, sub.Path) {
+			continue
+		}
+		opened, err := open(sub)
+		if err != nil {
+			return nil, err
+		}
+		return opened.FilesWithSubmodules(strings.TrimPrefix(strings.TrimPrefix(dir, sub.Path), "/"), open)
+	}
+
+	files, err := o.Files(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range submodules {
+		if !config.Within(sub.Path, dir) {
+			continue
+		}
+		opened, err := open(sub)
+		if err != nil {
+			return nil, err
+		}
+		subFiles, err := opened.FilesWithSubmodules(".", open)
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := sub.Path
+		if dir != "." {
+			prefix = strings.TrimPrefix(sub.Path, dir+"/")
+		}
+		for _, f := range subFiles {
+			f.Path = path.Join(prefix, f.Path)
+			files = append(files, f)
+		}
+	}
+
+	return files, nil
+}
+
+// submoduleURL resolves a URL of .gitmodules starting with ./ or ../ against the URL of the parent repository,
+// as git does: git@host:org/repo.git and ../other.git give git@host:org/other.git.
+func submoduleURL(parent, sub string) string {
+	if !strings.HasPrefix(sub, "./") && !strings.HasPrefix(sub, "../") {
+		return sub
+	}
+
+	parent = strings.TrimRight(parent, "/")
+
+	if u, err := url.Parse(parent); err == nil && u.Scheme != "" && u.Host != "" {
+		u.Path = path.Join(u.Path, sub)
+		return u.String()
+	}
+	if u, err := url.Parse(parent); err == nil && u.Scheme == "file" {
+		return "file://" + path.Join(u.Path, sub)
+	}
+	if host, p, ok := strings.Cut(parent, ":"); ok && !strings.Contains(host, "/") {
+		return host + ":" + path.Join(p, sub)
+	}
+
+	return path.Join(parent, sub)
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/n-r-w/protodep/internal/config"
+)
+
+// File is a file of the commit tree.
+type File struct {
+	// Path is relative to the directory passed to Files and uses forward slashes.
+	Path string
+	// name is the path from the repository root.
+	name   string
+	file   *object.File
+	opened *OpenedRepository
+}
+
+// Read returns the content of the file blob. A symlink is followed within the commit tree.
+func (f *File) Read() ([]byte, error) {
+	file := f.file
+	if file.Mode == filemode.Symlink {
+		var err error
+		if file, err = f.opened.followSymlink(f.name, file); err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.Path, err)
+		}
+	}
+
+	return readBlob(f.Path, file)
+}
+
+func readBlob(name string, f *object.File) ([]byte, error) {
+	reader, err := f.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// Files lists the files under dir of the commit tree. Only the trees under dir are read.
+func (o *OpenedRepository) Files(dir string) ([]File, error) {
+	tree, err := o.commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("tree of %s: %w", o.Hash, err)
+	}
+
+	dir = strings.Trim(path.Clean(dir), "/")
+	if dir != "." {
+		tree, err = tree.Tree(dir)
+		if err != nil {
+			return nil, fmt.Errorf("directory %s of %s: %w", dir, o.Hash, err)
+		}
+	}
+
+	var files []File
+	iter := tree.Files()
+	defer iter.Close()
+
+	for {
+		f, err := iter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("walk %s of %s: %w", dir, o.Hash, err)
+		}
+
+		files = append(files, File{Path: f.Name, name: path.Join(dir, f.Name), file: f, opened: o})
+	}
+
+	return files, nil
+}
+
+// ReadFile reads a file of the commit tree by its path from the repository root.
+// It returns os.ErrNotExist if the file doesn't exist.
+func (o *OpenedRepository) ReadFile(name string) ([]byte, error) {
+	f, err := o.commit.File(name)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, fmt.Errorf("%s of %s: %w", name, o.Hash, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s of %s: %w", name, o.Hash, err)
+	}
+	return (&File{Path: name, name: name, file: f, opened: o}).Read()
+}
+
+// maxSymlinks limits the symlinks followed to reach a file, so that a loop fails.
+const maxSymlinks = 40
+
+// followSymlink returns the file a symlink of the commit tree points to, following chained symlinks, the way a
+// checkout would. name is the path of the symlink from the repository root. A symlink leading outside the
+// repository, to a directory or to a missing file is an error.
+func (o *OpenedRepository) followSymlink(name string, link *object.File) (*object.File, error) {
+	f := link
+	for range maxSymlinks {
+		if f.Mode != filemode.Symlink {
+			return f, nil
+		}
+
+		target, err := readBlob(name, f)
+		if err != nil {
+			return nil, err
+		}
+		resolved := path.Join(path.Dir(name), string(target))
+		if path.IsAbs(string(target)) || !config.Inside(resolved) {
+			return nil, fmt.Errorf("symlink %s -> %s leads outside the repository", name, target)
+		}
+
+		if f, err = o.commit.File(resolved); err != nil {
+			return nil, fmt.Errorf("symlink %s -> %s is not a file of %s", name, target, o.Hash)
+		}
+		name = resolved
+	}
+
+	return nil, fmt.Errorf("symlink %s: too many levels of symlinks", name)
+}
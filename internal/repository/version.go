@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// TagVersion is a tag that is a semantic version.
+type TagVersion struct {
+	Tag     string
+	Version *semver.Version
+}
+
+// Versions returns the tags of the repository that are semantic versions, sorted from the lowest.
+func Versions(rep *git.Repository) ([]TagVersion, error) {
+	iter, err := rep.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		names = append(names, ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return SortVersions(names), nil
+}
+
+// SortVersions keeps the tags that are semantic versions and sorts them from the lowest.
+func SortVersions(tags []string) []TagVersion {
+	versions := make([]TagVersion, 0, len(tags))
+	for _, tag := range tags {
+		v, err := semver.NewVersion(tag)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, TagVersion{Tag: tag, Version: v})
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Version.LessThan(versions[j].Version)
+	})
+
+	return versions
+}
@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// plannedFile is the owner of a destination in proto_outdir.
+type plannedFile struct {
+	owner *resolvedDependency
+	file  resolvedFile
+}
+
+// resolveCollisions checks that no two dependencies write the same destination. A collision is allowed
+// if one of the dependencies sets on_conflict: "prefer" wins, "identical" keeps the first file if both are equal.
+// Files that lost are removed from their dependencies.
+func resolveCollisions(resolved []*resolvedDependency) error {
+	planned := make(map[string]plannedFile)
+	dropped := make(map[*resolvedDependency]map[string]bool)
+
+	drop := func(r *resolvedDependency, dest string) {
+		if dropped[r] == nil {
+			dropped[r] = make(map[string]bool)
+		}
+		dropped[r][dest] = true
+	}
+
+	for _, r := range resolved {
+		for _, f := range r.files {
+			dest := filepath.ToSlash(f.dest)
+
+			existing, ok := planned[dest]
+			if !ok {
+				planned[dest] = plannedFile{owner: r, file: f}
+				continue
+			}
+
+			first, second := &existing.owner.dep, &r.dep
+			collision := fmt.Errorf("%s is written by %s (%s) and %s (%s)",
+				dest, first.DisplayName(), existing.file.source, second.DisplayName(), f.source)
+
+			switch {
+			case first.OnConflict == config.OnConflictPrefer && second.OnConflict == config.OnConflictPrefer:
+				return fmt.Errorf("both dependencies prefer their file: %w", collision)
+			case second.OnConflict == config.OnConflictPrefer:
+				logger.Info("%s: using the file of %s", dest, second.DisplayName())
+				drop(existing.owner, dest)
+				planned[dest] = plannedFile{owner: r, file: f}
+			case first.OnConflict == config.OnConflictPrefer:
+				logger.Info("%s: using the file of %s", dest, first.DisplayName())
+				drop(r, dest)
+			case (first.OnConflict == config.OnConflictIdentical || second.OnConflict == config.OnConflictIdentical) &&
+				bytes.Equal(existing.file.content, f.content):
+				drop(r, dest)
+			default:
+				return fmt.Errorf("output path collision: %w", collision)
+			}
+		}
+	}
+
+	for r, dests := range dropped {
+		files := make([]resolvedFile, 0, len(r.files))
+		for _, f := range r.files {
+			if !dests[filepath.ToSlash(f.dest)] {
+				files = append(files, f)
+			}
+		}
+		r.files = files
+	}
+
+	return nil
+}
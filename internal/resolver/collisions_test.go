@@ -0,0 +1,47 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/n-r-w/protodep/internal/config"
+)
+
+func newCollidingDependency(target, onConflict, content string) *resolvedDependency {
+	return &resolvedDependency{
+		dep: config.ProtoDepDependency{Target: target, OnConflict: onConflict},
+		files: []resolvedFile{
+			{dest: "foo/foo.proto", source: target + "/foo/foo.proto", content: []byte(content)},
+			{dest: target + ".proto", source: target + "/own.proto", content: []byte(content)},
+		},
+	}
+}
+
+func TestResolveCollisions(t *testing.T) {
+	first := newCollidingDependency("a", "", "a")
+	second := newCollidingDependency("b", "", "b")
+	err := resolveCollisions([]*resolvedDependency{first, second})
+	require.EqualError(t, err, "output path collision: foo/foo.proto is written by a (a/foo/foo.proto) and b (b/foo/foo.proto)")
+
+	first = newCollidingDependency("a", "", "a")
+	second = newCollidingDependency("b", config.OnConflictPrefer, "b")
+	require.NoError(t, resolveCollisions([]*resolvedDependency{first, second}))
+	require.Len(t, first.files, 1)
+	require.Equal(t, "a.proto", first.files[0].dest)
+	require.Len(t, second.files, 2)
+
+	first = newCollidingDependency("a", config.OnConflictPrefer, "a")
+	second = newCollidingDependency("b", config.OnConflictPrefer, "b")
+	require.Error(t, resolveCollisions([]*resolvedDependency{first, second}))
+
+	first = newCollidingDependency("a", config.OnConflictIdentical, "same")
+	second = newCollidingDependency("b", "", "same")
+	require.NoError(t, resolveCollisions([]*resolvedDependency{first, second}))
+	require.Len(t, first.files, 2)
+	require.Len(t, second.files, 1)
+
+	first = newCollidingDependency("a", config.OnConflictIdentical, "a")
+	second = newCollidingDependency("b", "", "b")
+	require.Error(t, resolveCollisions([]*resolvedDependency{first, second}))
+}
@@ -3,6 +3,7 @@ package resolver
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/n-r-w/protodep/internal/auth"
 	"github.com/n-r-w/protodep/internal/logger"
@@ -21,6 +22,12 @@ type Config struct {
 	// HomeDir is the home directory, used as root to find ssh identity files.
 	HomeDir string
 
+	// CacheDir is the directory of the cached repositories. Defaults to .protodep in HomeDir.
+	CacheDir string
+
+	// LockTimeout is how long to wait for other processes using a cached repository. Zero means the default of the cache.
+	LockTimeout time.Duration
+
 	// TargetDir is the dependencies directory where protodep.toml files are located.
 	TargetDir string
 
@@ -38,6 +45,18 @@ type Config struct {
 
 	// IdentityPassword is used if `ssh` mode is enable. Optional, only if identity file needs a passphrase.
 	IdentityPassword string
+
+	// Jobs is the number of repositories fetched concurrently. Values below 1 mean 1.
+	Jobs int
+
+	// Offline resolves from the cache only, without contacting any remote.
+	Offline bool
+
+	// PreferOffline falls back to the cache with a warning if a remote can't be reached.
+	PreferOffline bool
+
+	// Update ignores the commits pinned in protodep.lock and resolves every dependency again.
+	Update bool
 }
 
 // GetHttpsAuthProvider returns auth provider for https
@@ -0,0 +1,179 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// Add checks that the dependency can be resolved and appends it to protodep.toml.
+// The repository is fetched into the cache, nothing is vendored.
+func (s *Resolver) Add(ctx context.Context, dep config.ProtoDepDependency) error {
+	cfg := config.NewDependency(s.conf.TargetDir)
+	protodep, err := cfg.Load()
+	if err != nil {
+		return err
+	}
+
+	if slices.ContainsFunc(protodep.Dependencies, func(d config.ProtoDepDependency) bool {
+		return dependencyKey(&d) == dependencyKey(&dep)
+	}) {
+		return fmt.Errorf("%s is already a dependency with path '%s'", dep.DisplayName(), dep.Path)
+	}
+
+	gitrepo, err := s.getRepository(dep, s.protodepDir())
+	if err != nil {
+		return err
+	}
+
+	refs, err := gitrepo.ListRemote(ctx)
+	if err != nil {
+		return fmt.Errorf("%s is not reachable: %w", dep.DisplayName(), err)
+	}
+	if err := classifyRev(&dep, refs); err != nil {
+		return err
+	}
+	gitrepo = gitrepo.ForDependency(dep)
+
+	opened, err := gitrepo.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("%s at %s: %w", dep.DisplayName(), dep.Requirement(), err)
+	}
+	opened.Close()
+
+	if err := cfg.AppendDependency(&dep); err != nil {
+		return err
+	}
+
+	logger.Info("added %s at %s (%s)", dep.DisplayName(), dep.Requirement(), opened.Hash)
+
+	return nil
+}
+
+// shortCommitPattern matches an abbreviated commit hash, which can't be fetched.
+var shortCommitPattern = regexp.MustCompile(`^[0-9a-f]{4,39}$`)
+
+// classifyRev decides whether the rev of a dependency given on the command line, guessed by
+// config.ParseDependencySpec, is a branch, a tag or a commit, looking at the remote references in that order.
+func classifyRev(dep *config.ProtoDepDependency, refs []*plumbing.Reference) error {
+	rev := dep.Branch + dep.Revision
+	if rev == "" {
+		return nil
+	}
+
+	dep.Branch, dep.Revision = "", ""
+	switch {
+	case slices.ContainsFunc(refs, func(ref *plumbing.Reference) bool { return ref.Name() == plumbing.NewBranchReferenceName(rev) }):
+		dep.Branch = rev
+	case slices.ContainsFunc(refs, func(ref *plumbing.Reference) bool { return ref.Name() == plumbing.NewTagReferenceName(rev) }):
+		dep.Revision = rev
+	case plumbing.IsHash(rev):
+		dep.Revision = rev
+	case shortCommitPattern.MatchString(rev):
+		return fmt.Errorf("%s: %s looks like an abbreviated commit hash, give the full 40 characters", dep.DisplayName(), rev)
+	default:
+		return fmt.Errorf("%s has no branch or tag %s", dep.DisplayName(), rev)
+	}
+
+	return nil
+}
+
+// Remove deletes a dependency from protodep.toml, its lock entry and its vendored files. The transitive dependencies
+// it pulled in may be required by other dependencies as well, they are left to the next up. protodep.toml is written
+// last, so that a failure leaves the dependency in place to remove again.
+func (s *Resolver) Remove(name string) error {
+	cfg := config.NewDependency(s.conf.TargetDir)
+	protodep, err := cfg.Load()
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i := range protodep.Dependencies {
+		if !protodep.Dependencies[i].Is(name) {
+			continue
+		}
+		if index >= 0 {
+			return fmt.Errorf("%s matches several dependencies of %s, give them unique names", name, config.FileName)
+		}
+		index = i
+	}
+	if index < 0 {
+		return fmt.Errorf("%s is not a dependency of %s", name, config.FileName)
+	}
+	dep := protodep.Dependencies[index]
+
+	lock, err := cfg.LoadLock()
+	if err != nil {
+		return err
+	}
+
+	// Direct dependencies sharing a target and path are locked in config order.
+	occurrence := 0
+	for _, other := range protodep.Dependencies[:index] {
+		if dependencyKey(&other) == dependencyKey(&dep) {
+			occurrence++
+		}
+	}
+
+	removed := -1
+	for i := range lock.Dependencies {
+		if len(lock.Dependencies[i].Via) > 0 || !lock.Dependencies[i].Matches(&dep) {
+			continue
+		}
+		if occurrence == 0 {
+			removed = i
+			break
+		}
+		occurrence--
+	}
+
+	if removed >= 0 {
+		// A file also locked by another dependency, e.g. with on_conflict, is still vendored.
+		kept := make(map[string]bool)
+		for i, locked := range lock.Dependencies {
+			if i == removed {
+				continue
+			}
+			for _, f := range locked.Files {
+				kept[f.Path] = true
+			}
+		}
+
+		outdir := filepath.Join(s.conf.OutputDir, protodep.ProtoOutdir)
+		for _, f := range lock.Dependencies[removed].Files {
+			if kept[f.Path] {
+				continue
+			}
+			if err := removeFile(outdir, filepath.FromSlash(f.Path)); err != nil {
+				return err
+			}
+		}
+
+		lock.Dependencies = slices.Delete(lock.Dependencies, removed, removed+1)
+		if err := cfg.SaveLock(lock); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.RemoveDependency(index); err != nil {
+		return err
+	}
+
+	if slices.ContainsFunc(lock.Dependencies, func(locked config.LockedDependency) bool {
+		return len(locked.Via) > 0 && locked.Via[0] == dep.DisplayName()
+	}) {
+		logger.Info("removed %s, run protodep up to drop the transitive dependencies no longer required", name)
+	} else {
+		logger.Info("removed %s", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package resolver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/n-r-w/protodep/internal/config"
+)
+
+func TestAddRemove(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.tag("v1.2.0", remote.commit(map[string]string{"proto/foo.proto": "foo"}))
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `# Vendored files
+proto_outdir = "./proto"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	dep := config.ProtoDepDependency{Target: "example.com/org/repo/proto", Protocol: "https", Path: "foo"}
+
+	dep.Revision = "v9.9.9"
+	require.Error(t, target.Add(context.Background(), dep))
+
+	// The rev guessed from the command line is checked against the remote.
+	dep.Revision = "1a2b3c4"
+	require.ErrorContains(t, target.Add(context.Background(), dep), "1a2b3c4 looks like an abbreviated commit hash")
+	dep.Revision = ""
+	dep.Branch = "release-2024"
+	require.ErrorContains(t, target.Add(context.Background(), dep), "has no branch or tag release-2024")
+
+	dep.Branch = "v1.2.0"
+	dep.Revision = ""
+	require.NoError(t, target.Add(context.Background(), dep))
+	dep.Branch = ""
+	dep.Revision = "v1.2.0"
+	require.Error(t, target.Add(context.Background(), dep))
+
+	protodep, err := config.NewDependency(targetDir).Load()
+	require.NoError(t, err)
+	require.Equal(t, []config.ProtoDepDependency{dep}, protodep.Dependencies)
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+	require.FileExists(t, filepath.Join(targetDir, "proto/foo/foo.proto"))
+
+	require.Error(t, target.Remove("example.com/org/unknown"))
+	require.NoError(t, target.Remove("example.com/org/repo/proto"))
+
+	require.NoFileExists(t, filepath.Join(targetDir, "proto/foo/foo.proto"))
+
+	content, err := os.ReadFile(filepath.Join(targetDir, config.FileName))
+	require.NoError(t, err)
+	require.Equal(t, "# Vendored files\nproto_outdir = \"./proto\"\n", string(content))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Empty(t, lock.Dependencies)
+}
+
+func TestRemoveKeepsTransitive(t *testing.T) {
+	c := newFixtureRepo(t)
+	c.tag("v1.0.0", c.commit(map[string]string{"c.proto": "c"}))
+
+	requiresC := `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/c"
+  revision = "v1.0.0"
+  protocol = "https"
+`
+	a := newFixtureRepo(t)
+	a.commit(map[string]string{"a.proto": "a", "protodep.toml": requiresC})
+	b := newFixtureRepo(t)
+	b.commit(map[string]string{"b.proto": "b", "protodep.toml": requiresC})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/a"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/b"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{
+		"example.com/org/a": a.URL(),
+		"example.com/org/b": b.URL(),
+		"example.com/org/c": c.URL(),
+	})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+	require.FileExists(t, filepath.Join(targetDir, "proto/c.proto"))
+
+	// c is pulled in through a, but b requires it too.
+	require.NoError(t, target.Remove("example.com/org/a"))
+
+	require.NoFileExists(t, filepath.Join(targetDir, "proto/a.proto"))
+	require.FileExists(t, filepath.Join(targetDir, "proto/b.proto"))
+	require.FileExists(t, filepath.Join(targetDir, "proto/c.proto"))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 2)
+	require.Equal(t, "example.com/org/b", lock.Dependencies[0].Target)
+	require.Equal(t, "example.com/org/c", lock.Dependencies[1].Target)
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+	require.FileExists(t, filepath.Join(targetDir, "proto/c.proto"))
+	require.NoError(t, target.Verify(context.Background()))
+}
@@ -0,0 +1,124 @@
+package resolver
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+var (
+	importPattern       = regexp.MustCompile(`(?m)^\s*import\s+(?:public\s+|weak\s+)?"([^"]+)"\s*;`)
+	lineCommentPattern  = regexp.MustCompile(`//[^\n]*`)
+	blockCommentPattern = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+// wellKnownPrefix is the prefix of the well-known types shipped with protoc. They are never reported as unresolved.
+const wellKnownPrefix = "google/protobuf/"
+
+// parseImports returns the files imported by a .proto file.
+func parseImports(content []byte) []string {
+	stripped := blockCommentPattern.ReplaceAll(content, nil)
+	stripped = lineCommentPattern.ReplaceAll(stripped, nil)
+
+	matches := importPattern.FindAllSubmatch(stripped, -1)
+	imports := make([]string, 0, len(matches))
+	for _, m := range matches {
+		imports = append(imports, string(m[1]))
+	}
+
+	return imports
+}
+
+// importClosure adds the files imported by the selected sources, transitively, as long as the dependency
+// contains them. An import is looked up both relative to proto_outdir and relative to the dependency root.
+// Imports missing in the dependency are returned as unresolved.
+func importClosure(dep config.ProtoDepDependency, sources, candidates []protoResource) ([]protoResource, []string, error) {
+	byImport := make(map[string]int, len(candidates)*2) //nolint:gomnd
+	for i := range candidates {
+		rel := filepath.ToSlash(candidates[i].relativeDest)
+		byImport[rel] = i
+		byImport[path.Join(filepath.ToSlash(dep.Path), rel)] = i
+	}
+
+	selected := make(map[string]bool, len(sources))
+	queue := make([]protoResource, 0, len(sources))
+	for _, src := range sources {
+		selected[src.relativeDest] = true
+		queue = append(queue, src)
+	}
+
+	contents := make(map[string][]byte, len(sources))
+	unresolved := make(map[string]bool)
+	for len(queue) > 0 {
+		src := queue[0]
+		queue = queue[1:]
+
+		content, err := src.read()
+		if err != nil {
+			return nil, nil, err
+		}
+		contents[src.relativeDest] = content
+
+		for _, imp := range parseImports(content) {
+			idx, ok := byImport[imp]
+			if !ok {
+				unresolved[imp] = true
+				continue
+			}
+
+			c := candidates[idx]
+			if selected[c.relativeDest] {
+				continue
+			}
+
+			logger.Info("%s: added %s imported by %s", dep.DisplayName(), filepath.ToSlash(c.relativeDest), filepath.ToSlash(src.relativeDest))
+			selected[c.relativeDest] = true
+			queue = append(queue, c)
+		}
+	}
+
+	// Keep the order of the candidates, so the result doesn't depend on the order imports were found in.
+	closure := make([]protoResource, 0, len(selected))
+	for _, c := range candidates {
+		if !selected[c.relativeDest] {
+			continue
+		}
+		content := contents[c.relativeDest]
+		c.read = func() ([]byte, error) {
+			return content, nil
+		}
+		closure = append(closure, c)
+	}
+
+	missing := make([]string, 0, len(unresolved))
+	for imp := range unresolved {
+		missing = append(missing, imp)
+	}
+	sort.Strings(missing)
+
+	return closure, missing, nil
+}
+
+// warnUnresolvedImports reports the imports that no resolved dependency provides.
+func warnUnresolvedImports(resolved []*resolvedDependency) {
+	provided := make(map[string]bool)
+	for _, r := range resolved {
+		for _, f := range r.files {
+			provided[filepath.ToSlash(f.dest)] = true
+		}
+	}
+
+	for _, r := range resolved {
+		for _, imp := range r.unresolvedImports {
+			if provided[imp] || strings.HasPrefix(imp, wellKnownPrefix) {
+				continue
+			}
+			logger.Warn("%s: import %s is not provided by any dependency", r.dep.DisplayName(), imp)
+		}
+	}
+}
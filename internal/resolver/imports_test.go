@@ -0,0 +1,73 @@
+package resolver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImports(t *testing.T) {
+	content := `syntax = "proto3";
+
+import "foo/v1/foo.proto";
+import public "foo/v1/public.proto";
+  import weak "foo/v1/weak.proto" ;
+// import "commented/line.proto";
+/*
+import "commented/block.proto";
+*/
+import "google/protobuf/empty.proto"; // trailing comment
+
+message Bar {}
+`
+
+	require.Equal(t, []string{
+		"foo/v1/foo.proto",
+		"foo/v1/public.proto",
+		"foo/v1/weak.proto",
+		"google/protobuf/empty.proto",
+	}, parseImports([]byte(content)))
+}
+
+func TestResolveImports(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{
+		"proto/foo/v1/service.proto": `syntax = "proto3";
+import "foo/v1/messages.proto";
+import "other/missing.proto";
+import "google/protobuf/empty.proto";
+`,
+		"proto/foo/v1/messages.proto": `syntax = "proto3";
+import "common/v1/common.proto";
+`,
+		"proto/common/v1/common.proto":       `syntax = "proto3";`,
+		"proto/unrelated/v1/unrelated.proto": `syntax = "proto3";`,
+	})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/proto"
+  includes = ["/foo/v1/service.proto"]
+  resolve_imports = true
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/foo/v1/service.proto")))
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/foo/v1/messages.proto")))
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/common/v1/common.proto")))
+	require.False(t, isFileExist(filepath.Join(targetDir, "proto/unrelated/v1/unrelated.proto")))
+}
@@ -0,0 +1,153 @@
+package resolver
+
+import (
+	"context"
+	"slices"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/repository"
+)
+
+// Kinds of OutdatedDependency.
+const (
+	OutdatedKindBranch  = "branch"
+	OutdatedKindTag     = "tag"
+	OutdatedKindVersion = "version"
+	OutdatedKindCommit  = "commit"
+)
+
+// OutdatedDependency compares a remote dependency with its remote.
+type OutdatedDependency struct {
+	Name   string `json:"name,omitempty"`
+	Target string `json:"target"`
+	// Kind tells how the dependency is pinned: branch, tag, version or commit.
+	Kind string `json:"kind"`
+	// Requirement is the branch, revision or version constraint of protodep.toml.
+	Requirement string `json:"requirement"`
+	// Current is the locked commit for a branch, otherwise the tag in use. It is empty if the dependency isn't locked.
+	Current string `json:"current"`
+	// Wanted is the head commit of the branch, the newest tag matching the version constraint or the tag itself.
+	// A dependency is outdated if Current differs from it, except for tags.
+	Wanted string `json:"wanted"`
+	// Latest is the head commit of the branch, otherwise the newest semantic version tag of the remote.
+	// A tag is outdated if Latest is a newer version. It is empty for a tag that isn't a semantic version.
+	Latest   string `json:"latest"`
+	Outdated bool   `json:"outdated"`
+}
+
+// Outdated checks the remote dependencies of protodep.toml against their remotes. Nothing is fetched or vendored.
+func (s *Resolver) Outdated(ctx context.Context) ([]OutdatedDependency, error) {
+	dep := config.NewDependency(s.conf.TargetDir)
+	protodep, err := dep.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := dep.LoadLock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]OutdatedDependency, 0, len(protodep.Dependencies))
+	for _, dep := range protodep.Dependencies {
+		if dep.Target == "" {
+			continue
+		}
+
+		gitrepo, err := s.getRepository(dep, s.protodepDir())
+		if err != nil {
+			return nil, err
+		}
+
+		refs, err := gitrepo.ListRemote(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, outdatedDependency(dep, lock.Find(&dep), refs))
+	}
+
+	return result, nil
+}
+
+func outdatedDependency(dep config.ProtoDepDependency, locked *config.LockedDependency, refs []*plumbing.Reference,
+) OutdatedDependency {
+	var tags []string
+	for _, ref := range refs {
+		if ref.Name().IsTag() {
+			tags = append(tags, ref.Name().Short())
+		}
+	}
+
+	versions := repository.SortVersions(tags)
+	var latest *repository.TagVersion
+	if len(versions) > 0 {
+		latest = &versions[len(versions)-1]
+	}
+
+	result := OutdatedDependency{Name: dep.Name, Target: dep.Target}
+
+	switch {
+	case dep.Version != "":
+		result.Kind = OutdatedKindVersion
+		result.Requirement = dep.Version
+		if locked != nil && locked.IsPinned(&dep) {
+			result.Current = plumbing.ReferenceName(locked.Ref).Short()
+		}
+		if latest != nil {
+			result.Latest = latest.Tag
+		}
+		if constraint, err := dep.VersionConstraint(); err == nil {
+			for i := len(versions) - 1; i >= 0; i-- {
+				if constraint.Check(versions[i].Version) {
+					result.Wanted = versions[i].Tag
+					break
+				}
+			}
+		}
+		result.Outdated = result.Wanted != "" && result.Current != result.Wanted
+	case dep.Revision != "":
+		result.Requirement = dep.Revision
+		result.Current = dep.Revision
+		if !slices.Contains(tags, dep.Revision) {
+			result.Kind = OutdatedKindCommit
+			return result
+		}
+		result.Kind = OutdatedKindTag
+		result.Wanted = dep.Revision
+		// Only a semantic version can be compared with the newest version of the remote.
+		if current, err := semver.NewVersion(dep.Revision); err == nil && latest != nil {
+			result.Latest = latest.Tag
+			result.Outdated = latest.Version.GreaterThan(current)
+		}
+	default:
+		result.Kind = OutdatedKindBranch
+		result.Requirement = remoteBranch(dep.Branch, refs)
+		if locked != nil && locked.IsPinned(&dep) {
+			result.Current = locked.Commit
+		}
+		for _, ref := range refs {
+			if ref.Name() == plumbing.NewBranchReferenceName(result.Requirement) {
+				result.Wanted = ref.Hash().String()
+				result.Latest = result.Wanted
+			}
+		}
+		result.Outdated = result.Wanted != "" && result.Current != result.Wanted
+	}
+
+	return result
+}
+
+// remoteBranch returns the branch tracked by the dependency, the default branch of the remote if none is set.
+// It is empty if the remote doesn't tell its default branch.
+func remoteBranch(branch string, refs []*plumbing.Reference) string {
+	if branch != "" {
+		return branch
+	}
+
+	branch, _ = repository.DefaultBranch(refs)
+	return branch
+}
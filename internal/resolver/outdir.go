@@ -0,0 +1,147 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// stageOutdir lets fill populate a staging directory and swaps it with outdir, so that an error or an interrupt
+// leaves the previous outdir untouched.
+func stageOutdir(ctx context.Context, outdir string, fill func(staging string) error) error {
+	staging, err := newStagingDir(outdir)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := fill(staging); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return replaceDir(outdir, staging)
+}
+
+// writeFiles writes files under dir, stopping when ctx is done.
+func writeFiles(ctx context.Context, dir string, files []resolvedFile) error {
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := writeFileWithDirectory(filepath.Join(dir, f.dest), f.content, 0o644); err != nil { //nolint:gomnd
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyDir copies the content of src into the existing directory dst, keeping modes and symbolic links.
+// Nothing is copied if src doesn't exist.
+func copyDir(ctx context.Context, src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(target, content, info.Mode().Perm())
+		default:
+			return fmt.Errorf("copy %s: not a regular file", path)
+		}
+	})
+}
+
+// newStagingDir creates an empty directory next to outdir. Being on the same filesystem,
+// it can be renamed to outdir atomically. It has the mode of outdir, or 0750 if outdir doesn't exist yet.
+func newStagingDir(outdir string) (string, error) {
+	parent := filepath.Dir(outdir)
+	if err := os.MkdirAll(parent, 0o750); err != nil { //nolint:gomnd
+		return "", fmt.Errorf("create directory %s: %w", parent, err)
+	}
+
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(outdir)+".staging-*")
+	if err != nil {
+		return "", fmt.Errorf("create staging directory: %w", err)
+	}
+
+	// MkdirTemp creates the directory with mode 0700.
+	mode := os.FileMode(0o750) //nolint:gomnd
+	if info, err := os.Stat(outdir); err == nil && info.IsDir() {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(staging, mode); err != nil {
+		os.RemoveAll(staging)
+		return "", fmt.Errorf("set mode of staging directory: %w", err)
+	}
+
+	return staging, nil
+}
+
+// replaceDir swaps dir with staging. The previous content of dir is restored if the swap fails.
+func replaceDir(dir, staging string) error {
+	backup := ""
+
+	if _, err := os.Stat(dir); err == nil {
+		backup = staging + ".old"
+		if err := os.Rename(dir, backup); err != nil {
+			return fmt.Errorf("move %s aside: %w", dir, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Rename(staging, dir); err != nil {
+		if backup != "" {
+			if restoreErr := os.Rename(backup, dir); restoreErr != nil {
+				return fmt.Errorf("replace %s: %w (previous content is kept in %s)", dir, err, backup)
+			}
+		}
+		return fmt.Errorf("replace %s: %w", dir, err)
+	}
+
+	if backup != "" {
+		if err := os.RemoveAll(backup); err != nil {
+			return fmt.Errorf("remove %s: %w", backup, err)
+		}
+	}
+
+	return nil
+}
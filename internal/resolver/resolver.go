@@ -1,22 +1,58 @@
 package resolver
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/gobwas/glob"
 	"github.com/n-r-w/protodep/internal/auth"
+	"github.com/n-r-w/protodep/internal/cache"
 	"github.com/n-r-w/protodep/internal/config"
 	"github.com/n-r-w/protodep/internal/logger"
 	"github.com/n-r-w/protodep/internal/repository"
 )
 
+// maxResolveRounds limits how often the dependency graph is resolved again after transitive requirements replaced
+// requirements whose own dependencies had been added.
+const maxResolveRounds = 10
+
 type protoResource struct {
 	source       string
 	relativeDest string
+	read         func() ([]byte, error)
+}
+
+// resolvedFile is a file of a dependency read into memory. dest is relative to proto_outdir.
+type resolvedFile struct {
+	dest    string
+	source  string
+	content []byte
+}
+
+// fetchState tracks the requirements of a cached repository that have already been fetched during the run.
+// Only the reference a dependency requires is fetched, so dependencies with other requirements fetch again.
+type fetchState struct {
+	fetched map[string]bool
+}
+
+type resolvedDependency struct {
+	dep    config.ProtoDepDependency
+	files  []resolvedFile
+	locked config.LockedDependency
+	// nested are the dependencies of protodep.toml found in the dependency repository.
+	nested  []config.ProtoDepDependency
+	pending *pendingDependency
+	// unresolvedImports are imports of the files that were not found in the dependency itself.
+	unresolvedImports []string
 }
 
 type Resolver struct {
@@ -54,90 +90,446 @@ func New(conf *Config, httpsProvider, sshProvider auth.AuthProvider) (*Resolver,
 	return s, nil
 }
 
-func (s *Resolver) Resolve(cleanupCache bool) error { //nolint:gocognit
+// Resolve vendors the dependencies of protodep.toml into proto_outdir and writes protodep.lock.
+// Files are written to a staging directory that replaces proto_outdir only after every dependency
+// has been resolved, so an error or an interrupt leaves the previous proto_outdir untouched.
+func (s *Resolver) Resolve(ctx context.Context, cleanupCache bool) error { //nolint:gocognit
 	dep := config.NewDependency(s.conf.TargetDir)
 	protodep, err := dep.Load()
 	if err != nil {
 		return err
 	}
 
-	protodepDir := filepath.Join(s.conf.HomeDir, ".protodep")
+	lock, err := dep.LoadLock()
+	if err != nil {
+		return err
+	}
+
+	protodepDir := s.protodepDir()
 
-	_, err = os.Stat(protodepDir)
-	if cleanupCache && err == nil {
-		files, err := os.ReadDir(protodepDir)
+	if cleanupCache {
+		entries, err := cache.List(protodepDir)
 		if err != nil {
 			return err
 		}
-		for _, file := range files {
-			if file.IsDir() {
-				dirpath := filepath.Join(protodepDir, file.Name())
-				if err := os.RemoveAll(dirpath); err != nil {
-					return err
-				}
+		// Each repository is removed under its lock, so that processes using it aren't disturbed.
+		for _, e := range entries {
+			if err := cache.Remove(ctx, protodepDir, e.Repository, s.conf.LockTimeout); err != nil {
+				return err
 			}
 		}
 	}
 
+	resolved, newLock, err := s.resolveAll(ctx, protodep, protodepDir, lock, s.updateAll)
+	if err != nil {
+		return err
+	}
+
+	var files []resolvedFile
+	for _, r := range resolved {
+		files = append(files, r.files...)
+	}
+
 	outdir := filepath.Join(s.conf.OutputDir, protodep.ProtoOutdir)
-	if err := os.RemoveAll(outdir); err != nil {
+	if err := stageOutdir(ctx, outdir, func(staging string) error {
+		return writeFiles(ctx, staging, files)
+	}); err != nil {
 		return err
 	}
 
-	for _, dep := range protodep.Dependencies {
-		var sources []protoResource
+	return dep.SaveLock(newLock)
+}
 
-		if dep.Target != "" && dep.LocalFolder != "" {
-			return fmt.Errorf("target and local_folder cannot be set together")
+// resolveAll resolves every dependency of protodep.toml and their transitive dependencies into memory.
+// Results keep the config order, transitive dependencies follow in the order they were discovered.
+// Dependencies for which update returns true ignore their pin in the lock.
+func (s *Resolver) resolveAll(ctx context.Context, protodep *config.ProtoDep, protodepDir string, lock *config.ProtoDepLock,
+	update func(p *pendingDependency) bool,
+) ([]*resolvedDependency, *config.ProtoDepLock, error) {
+	var (
+		graph    *dependencyGraph
+		resolved []*resolvedDependency
+		// superseded are the requirements replaced by another one after their own dependencies were added.
+		// The graph is resolved again without those dependencies, until the replaced requirements don't change.
+		superseded map[string]bool
+		// done keeps the dependencies already resolved, so that resolving again fetches nothing twice.
+		done = make(map[string]*resolvedDependency)
+	)
+	for round := 0; ; round++ {
+		if round == maxResolveRounds {
+			return nil, nil, errors.New("transitive requirements keep replacing each other, pin the dependencies in protodep.toml")
 		}
 
-		if dep.LocalFolder != "" {
-			if dep.Subgroup != "" || dep.Revision != "" || dep.Branch != "" ||
-				dep.Protocol != "" || dep.UsernameEnv != "" || dep.PasswordEnv != "" {
-				return fmt.Errorf("subgroup, revision, branch, path, protocol and username_env cannot be set together with local_folder")
-			}
-
-			localFolder, err := filepath.Abs(dep.LocalFolder)
+		graph = newDependencyGraph(protodep.Dependencies, superseded)
+		resolved = nil
+		for pending := graph.pending; len(pending) > 0; {
+			level, err := s.resolveLevel(ctx, pending, protodepDir, lock, update, done)
 			if err != nil {
-				return fmt.Errorf("invalid local_folder: %w", err)
+				return nil, nil, err
 			}
+			resolved = append(resolved, level...)
 
-			sources, err = s.getSources(dep, localFolder)
-			if err != nil {
-				return err
-			}
-		} else if dep.Target != "" {
-			gitrepo, err := s.getRepository(dep, protodepDir)
-			if err != nil {
-				return err
-			}
-			if _, err = gitrepo.Open(); err != nil {
-				return err
+			if pending, err = graph.next(level); err != nil {
+				return nil, nil, err
 			}
-			sources, err = s.getSources(dep, gitrepo.ProtoRootDir())
-			if err != nil {
-				return err
+		}
+
+		replaced := graph.replaced(resolved)
+		if maps.Equal(replaced, superseded) {
+			break
+		}
+		superseded = replaced
+		logger.Info("resolving again without the dependencies of replaced transitive requirements")
+	}
+	resolved = graph.chosen(resolved)
+	warnUnresolvedImports(resolved)
+
+	if err := resolveCollisions(resolved); err != nil {
+		return nil, nil, err
+	}
+
+	newLock := &config.ProtoDepLock{}
+	for _, r := range resolved {
+		r.locked.Files = lockFiles(r.files)
+		newLock.Dependencies = append(newLock.Dependencies, r.locked)
+	}
+
+	return resolved, newLock, nil
+}
+
+// resolveLevel resolves the dependencies like resolveParallel, reusing the ones already in done.
+func (s *Resolver) resolveLevel(ctx context.Context, pending []*pendingDependency, protodepDir string, lock *config.ProtoDepLock,
+	update func(p *pendingDependency) bool, done map[string]*resolvedDependency,
+) ([]*resolvedDependency, error) {
+	var missing []*pendingDependency
+	for _, p := range pending {
+		if done[p.key] == nil {
+			missing = append(missing, p)
+		}
+	}
+
+	if len(missing) > 0 {
+		resolved, err := s.resolveParallel(ctx, missing, protodepDir, lock, update)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range missing {
+			done[p.key] = resolved[i]
+		}
+	}
+
+	level := make([]*resolvedDependency, 0, len(pending))
+	for _, p := range pending {
+		r := *done[p.key]
+		r.pending = p
+		r.locked.Via = p.via
+		level = append(level, &r)
+	}
+
+	return level, nil
+}
+
+// resolveParallel resolves the dependencies into memory.
+// Up to Config.Jobs repositories are fetched concurrently. Dependencies sharing a repository are resolved
+// one after another by the same worker, so the repository is fetched only once. Results keep the order of deps.
+func (s *Resolver) resolveParallel(ctx context.Context, pending []*pendingDependency, protodepDir string, lock *config.ProtoDepLock,
+	update func(p *pendingDependency) bool,
+) ([]*resolvedDependency, error) {
+	deps := make([]config.ProtoDepDependency, 0, len(pending))
+	for _, p := range pending {
+		deps = append(deps, p.dep)
+	}
+
+	resolved := make([]*resolvedDependency, len(deps))
+	groups := groupByRepository(deps)
+
+	jobs := s.conf.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(groups) {
+		jobs = len(groups)
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	// notCached keeps the errors of the dependencies missing in the cache in offline mode, so that all of them are reported.
+	notCached := make([]error, len(deps))
+
+	tasks := make(chan []int)
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range tasks {
+				state := &fetchState{fetched: make(map[string]bool)}
+				for _, idx := range group {
+					if workerCtx.Err() != nil {
+						break
+					}
+
+					r, err := s.resolveDependency(workerCtx, deps[idx], protodepDir, lock, state, update(pending[idx]))
+					if errors.Is(err, repository.ErrNotCached) {
+						notCached[idx] = err
+						continue
+					}
+					if err != nil {
+						errOnce.Do(func() {
+							firstErr = err
+							cancel()
+						})
+						break
+					}
+					r.pending = pending[idx]
+					r.locked.Via = pending[idx].via
+					resolved[idx] = r
+				}
 			}
+		}()
+	}
+
+	for _, group := range groups {
+		if workerCtx.Err() != nil {
+			break
+		}
+		tasks <- group
+	}
+	close(tasks)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := errors.Join(notCached...); err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+// groupByRepository returns indexes of the dependencies grouped by their repository, in config order.
+// Every local dependency forms its own group.
+func groupByRepository(deps []config.ProtoDepDependency) [][]int {
+	groups := make([][]int, 0, len(deps))
+	byRepository := make(map[string]int)
+
+	for idx := range deps {
+		if deps[idx].Target == "" {
+			groups = append(groups, []int{idx})
+			continue
+		}
+
+		reponame := deps[idx].Repository()
+		if g, ok := byRepository[reponame]; ok {
+			groups[g] = append(groups[g], idx)
+			continue
+		}
+
+		byRepository[reponame] = len(groups)
+		groups = append(groups, []int{idx})
+	}
+
+	return groups
+}
+
+// lockURL is the url of a target recorded in protodep.lock. The clone URL depends on the auth flags of the machine,
+// e.g. ssh or https, so that only the host and the path are kept. A local repository is recorded as is.
+func lockURL(raw string) string {
+	u, err := config.ParseRepositoryURL(raw)
+	if err != nil || u.IsLocal() {
+		return raw
+	}
+	return u.Canonical()
+}
+
+// lockFiles returns the lock entries of the vendored files.
+func lockFiles(files []resolvedFile) []config.LockedFile {
+	locked := make([]config.LockedFile, 0, len(files))
+	for _, f := range files {
+		sum := sha256.Sum256(f.content)
+		locked = append(locked, config.LockedFile{
+			Path:   filepath.ToSlash(f.dest),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	return locked
+}
+
+// updateAll applies Config.Update to every dependency.
+func (s *Resolver) updateAll(*pendingDependency) bool {
+	return s.conf.Update
+}
+
+func (s *Resolver) protodepDir() string {
+	if s.conf.CacheDir != "" {
+		return s.conf.CacheDir
+	}
+	return cache.LegacyDir(s.conf.HomeDir)
+}
+
+// resolveDependency reads the files of a dependency into memory and pins them in a lock entry.
+// Unless update is set, a dependency pinned by the lock is resolved at the locked commit.
+func (s *Resolver) resolveDependency(ctx context.Context, dep config.ProtoDepDependency, protodepDir string,
+	lock *config.ProtoDepLock, state *fetchState, update bool,
+) (*resolvedDependency, error) {
+	var (
+		candidates   []protoResource
+		protoRootDir string
+		// extras are the files of extra_paths, matched against includes and ignores from the repository root.
+		extras      []protoResource
+		repoRootDir string
+		nested      []config.ProtoDepDependency
+	)
+
+	locked := config.LockedDependency{
+		Name:        dep.Name,
+		Target:      dep.Target,
+		LocalFolder: dep.LocalFolder,
+		Path:        dep.Path,
+		Branch:      dep.Branch,
+		Revision:    dep.Revision,
+		Version:     dep.Version,
+	}
+
+	if dep.Target != "" && dep.LocalFolder != "" {
+		return nil, fmt.Errorf("target and local_folder cannot be set together")
+	}
+
+	if dep.LocalFolder != "" {
+		if dep.Subgroup != "" || dep.Revision != "" || dep.Branch != "" || dep.Version != "" ||
+			dep.Protocol != "" || dep.UsernameEnv != "" || dep.PasswordEnv != "" || len(dep.ExtraPaths) > 0 || dep.Submodules {
+			return nil, fmt.Errorf("subgroup, revision, branch, version, path, protocol, username_env, extra_paths and submodules cannot be set together with local_folder")
+		}
+
+		localFolder, err := filepath.Abs(dep.LocalFolder)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local_folder: %w", err)
+		}
+
+		protoRootDir = localFolder
+		if candidates, err = listLocalFiles(localFolder); err != nil {
+			return nil, err
+		}
+	} else if dep.Target != "" {
+		gitrepo, err := s.getRepository(dep, protodepDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if state.fetched[dep.Requirement()] {
+			gitrepo.SkipFetch()
+		}
+
+		var opened *repository.OpenedRepository
+		if pinned := lock.Find(&dep); pinned != nil && pinned.IsPinned(&dep) && !update {
+			logger.Info("using %s locked at %s", dep.DisplayName(), pinned.Commit)
+			opened, err = gitrepo.OpenCommit(ctx, pinned.Commit, pinned.Ref)
 		} else {
-			return fmt.Errorf("target or local_folder must be set")
+			opened, err = gitrepo.Open(ctx)
 		}
+		if err != nil {
+			return nil, err
+		}
+		// The files are read from the cache until the end, it stays locked until then.
+		defer opened.Close()
 
-		for _, s := range sources {
-			outpath := filepath.Join(outdir, dep.Path, s.relativeDest)
+		if opened.Fetched {
+			state.fetched[dep.Requirement()] = true
+		}
 
-			content, err := os.ReadFile(s.source)
-			if err != nil {
-				return err
+		configPath := filepath.Join(s.conf.TargetDir, config.FileName)
+		if err = cache.Record(protodepDir, gitrepo.Repository(), configPath, opened.Fetched); err != nil {
+			logger.Warn("%s: %v", dep.DisplayName(), err)
+		}
+
+		locked.Ref = opened.Ref
+		locked.Commit = opened.Hash
+		locked.URL = lockURL(opened.URL)
+		if dep.URL != "" {
+			// The url as written, so that a relative local path doesn't make the lock depend on the checkout location.
+			locked.URL = dep.URL
+		}
+
+		listFiles := opened.Files
+		if dep.Submodules {
+			open, closeSubmodules := s.submoduleOpener(ctx, dep, protodepDir, opened)
+			defer closeSubmodules()
+			listFiles = func(dir string) ([]repository.File, error) {
+				return opened.FilesWithSubmodules(dir, open)
 			}
+		}
 
-			if err := writeFileWithDirectory(outpath, content, 0o644); err != nil { //nolint:gomnd
-				return err
+		files, err := listFiles(dep.Directory())
+		if err != nil {
+			return nil, err
+		}
+		protoRootDir = gitrepo.ProtoRootDir()
+		candidates = repositoryFiles(protoRootDir, "", files)
+
+		repoRootDir = gitrepo.RootDir()
+		for _, extra := range dep.ExtraPaths {
+			if files, err = listFiles(extra); err != nil {
+				return nil, err
 			}
+			extras = append(extras, repositoryFiles(repoRootDir, extra, files)...)
 		}
 
+		if !dep.SkipTransitive {
+			if nested, err = readNestedDependencies(opened); err != nil {
+				return nil, fmt.Errorf("%s: %w", dep.DisplayName(), err)
+			}
+		}
+	} else {
+		return nil, fmt.Errorf("target or local_folder must be set")
 	}
 
-	return nil
+	sources := s.getSources(dep, protoRootDir, candidates)
+	if len(extras) > 0 {
+		sources = append(sources, s.getSources(dep, repoRootDir, extras)...)
+		candidates = append(candidates, extras...)
+	}
+
+	var unresolvedImports []string
+	if dep.ResolveImports {
+		var err error
+		if sources, unresolvedImports, err = importClosure(dep, sources, candidates); err != nil {
+			return nil, err
+		}
+	}
+
+	resolved := &resolvedDependency{
+		dep:               dep,
+		files:             make([]resolvedFile, 0, len(sources)),
+		nested:            nested,
+		unresolvedImports: unresolvedImports,
+	}
+
+	for _, src := range sources {
+		content, err := src.read()
+		if err != nil {
+			return nil, err
+		}
+
+		dest := filepath.Join(dep.Path, src.relativeDest)
+		resolved.files = append(resolved.files, resolvedFile{
+			dest:    dest,
+			source:  src.source,
+			content: content,
+		})
+	}
+
+	resolved.locked = locked
+
+	return resolved, nil
 }
 
 func (s *Resolver) getRepository(dep config.ProtoDepDependency, protodepDir string) (*repository.Git, error) { //nolint:gocognit
@@ -146,6 +538,29 @@ func (s *Resolver) getRepository(dep config.ProtoDepDependency, protodepDir stri
 		userName, userPassword string
 	)
 
+	// The protocol of a dependency given by url is the one of the url, --use-https doesn't apply.
+	protocol, useHTTPS := dep.Protocol, s.conf.UseHttps
+	// sshUser is the user of an ssh url, e.g. a personal Gerrit account, used instead of the default user.
+	var sshUser string
+	if dep.URL != "" {
+		u, err := config.ParseRepositoryURL(dep.URL)
+		if err != nil {
+			return nil, err
+		}
+		if u.IsLocal() {
+			// A local repository needs no credentials.
+			return s.newGit(dep, protodepDir, nil), nil
+		}
+		if u.Scheme == "git" {
+			// The git protocol has no authentication.
+			return s.newGit(dep, protodepDir, nil), nil
+		}
+		protocol, useHTTPS = u.Protocol(), false
+		if protocol == "ssh" {
+			sshUser = u.User
+		}
+	}
+
 	if dep.PasswordEnv != "" || dep.UsernameEnv != "" {
 		if dep.UsernameEnv == "" || dep.PasswordEnv == "" {
 			return nil, fmt.Errorf("auth_username_env and auth_password_env must be set together")
@@ -162,12 +577,14 @@ func (s *Resolver) getRepository(dep config.ProtoDepDependency, protodepDir stri
 			return nil, fmt.Errorf("auth_password_env %s is empty", dep.PasswordEnv)
 		}
 
-		logger.Info("using name and password from environment variables")
+		logger.Info("%s: using name and password from environment variables", dep.DisplayName())
 
 	} else {
 		if s.conf.UseGitCredentialsHelper && s.gitCredentialsProvider != nil {
 			targetRepo := dep.Repository()
-			if s.conf.UseHttps {
+			if dep.URL != "" {
+				targetRepo = dep.URL
+			} else if s.conf.UseHttps {
 				targetRepo = "https://" + targetRepo
 			}
 
@@ -210,18 +627,18 @@ func (s *Resolver) getRepository(dep config.ProtoDepDependency, protodepDir stri
 		}
 	}
 
-	if s.conf.UseHttps || dep.Protocol == "https" || (dep.Protocol == "" && userName != "") {
+	if useHTTPS || protocol == "https" || (protocol == "" && userName != "") {
 		if userName != "" {
 			authProvider = auth.NewAuthProvider(auth.WithHTTPS(userName, userPassword))
 		} else {
 			authProvider = s.httpsProvider
 		}
 	} else {
-		if dep.Protocol == "ssh" {
+		if protocol == "ssh" {
 			if dep.UsernameEnv != "" {
 				return nil, fmt.Errorf("auth_username_env and auth_password_env are not supported for ssh protocol")
 			}
-			authProvider = s.sshProvider
+			authProvider = auth.WithSSHUser(s.sshProvider, sshUser)
 		}
 	}
 
@@ -229,43 +646,185 @@ func (s *Resolver) getRepository(dep config.ProtoDepDependency, protodepDir stri
 		return nil, fmt.Errorf("no auth provider found")
 	}
 
-	return repository.NewGit(protodepDir, dep, authProvider), nil
+	return s.newGit(dep, protodepDir, authProvider), nil
 }
 
-func (s *Resolver) getSources(dep config.ProtoDepDependency, protoRootDir string) ([]protoResource, error) {
-	sources := make([]protoResource, 0)
+// submoduleOpener returns a function opening the submodules of dep at their recorded commits, and a function closing
+// the opened ones. A submodule is cached like a dependency given by its url, with the credentials resolved the same
+// way as for dep. parent is the opened repository of dep, whose lock is held.
+func (s *Resolver) submoduleOpener(ctx context.Context, dep config.ProtoDepDependency, protodepDir string,
+	parent *repository.OpenedRepository,
+) (func(repository.Submodule) (*repository.OpenedRepository, error), func()) {
+	opened := make(map[string]*repository.OpenedRepository)
+	// held are the repositories locked while dep is resolved, so that another commit of them doesn't wait for the lock.
+	held := map[string]*repository.OpenedRepository{parent.Dep.Repository(): parent}
+
+	closeAll := func() {
+		for _, o := range opened {
+			o.Close()
+		}
+	}
 
-	compiledIgnores := compileIgnoreToGlob(dep.Ignores)
-	compiledIncludes := compileIgnoreToGlob(dep.Includes)
+	return func(sub repository.Submodule) (*repository.OpenedRepository, error) {
+		key := sub.URL + "@" + sub.Commit
+		if o, ok := opened[key]; ok {
+			return o, nil
+		}
 
-	hasIncludes := len(dep.Includes) > 0
+		subDep, err := submoduleDependency(dep, sub)
+		if err != nil {
+			return nil, fmt.Errorf("%s: submodule %s: %w", dep.DisplayName(), sub.Path, err)
+		}
 
-	err := filepath.Walk(protoRootDir, func(path string, info os.FileInfo, err error) error {
+		gitrepo, err := s.getRepository(subDep, protodepDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: submodule %s: %w", dep.DisplayName(), sub.Path, err)
+		}
+
+		logger.Info("using submodule %s of %s at %s", sub.Path, dep.DisplayName(), sub.Commit)
+		var o *repository.OpenedRepository
+		if h, ok := held[gitrepo.Repository()]; ok {
+			o, err = gitrepo.OpenCommitLocked(ctx, h, sub.Commit, "")
+		} else {
+			o, err = gitrepo.OpenCommit(ctx, sub.Commit, "")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: submodule %s: %w", dep.DisplayName(), sub.Path, err)
+		}
+		if _, ok := held[gitrepo.Repository()]; !ok {
+			held[gitrepo.Repository()] = o
+		}
+
+		configPath := filepath.Join(s.conf.TargetDir, config.FileName)
+		if err = cache.Record(protodepDir, gitrepo.Repository(), configPath, o.Fetched); err != nil {
+			logger.Warn("%s: %v", subDep.DisplayName(), err)
+		}
+
+		opened[key] = o
+		return o, nil
+	}, closeAll
+}
+
+// submoduleDependency returns the dependency a submodule of dep is fetched as. The url of a submodule is chosen by
+// the repository, so that the username_env and password_env of dep only apply to the host of dep, and a remote
+// repository can't make protodep read a local one, as git doesn't by default.
+func submoduleDependency(dep config.ProtoDepDependency, sub repository.Submodule) (config.ProtoDepDependency, error) {
+	u, err := config.ParseRepositoryURL(sub.URL)
+	if err != nil {
+		return config.ProtoDepDependency{}, err
+	}
+	if u.IsLocal() && (dep.URL == "" || !isLocalURL(dep.URL)) {
+		return config.ProtoDepDependency{}, fmt.Errorf("local url %s of a remote repository is not allowed", sub.URL)
+	}
+
+	parent := dep.Name
+	if parent == "" {
+		parent = dep.Repository()
+	}
+	subDep := config.ProtoDepDependency{
+		Name:  parent + "/" + sub.Path,
+		URL:   sub.URL,
+		Depth: dep.Depth,
+	}
+	if strings.EqualFold(u.Host, dep.Machine()) {
+		subDep.UsernameEnv = dep.UsernameEnv
+		subDep.PasswordEnv = dep.PasswordEnv
+	}
+
+	return subDep, nil
+}
+
+func (s *Resolver) newGit(dep config.ProtoDepDependency, protodepDir string, authProvider auth.AuthProvider) *repository.Git {
+	gitrepo := repository.NewGit(protodepDir, dep, authProvider)
+	gitrepo.SetLockTimeout(s.conf.LockTimeout)
+	switch {
+	case s.conf.Offline:
+		gitrepo.SetMode(repository.ModeOffline)
+	case s.conf.PreferOffline:
+		gitrepo.SetMode(repository.ModePreferOffline)
+	}
+
+	return gitrepo
+}
+
+// listLocalFiles returns the .proto files under root.
+func listLocalFiles(root string) ([]protoResource, error) {
+	var files []protoResource
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if strings.HasSuffix(path, ".proto") {
-			isIncludePath := s.isMatchPath(protoRootDir, path, dep.Includes, compiledIncludes)
-			isIgnorePath := s.isMatchPath(protoRootDir, path, dep.Ignores, compiledIgnores)
+		if info.IsDir() || !strings.HasSuffix(path, ".proto") {
+			return nil
+		}
 
-			if hasIncludes && !isIncludePath {
-				logger.Info("skipped %s due to include setting", path)
-			} else if isIgnorePath {
-				logger.Info("skipped %s due to ignore setting", path)
-			} else {
-				sources = append(sources, protoResource{
-					source:       path,
-					relativeDest: strings.Replace(path, protoRootDir, "", -1),
-				})
-			}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
 		}
+
+		files = append(files, protoResource{
+			source:       path,
+			relativeDest: rel,
+			read: func() ([]byte, error) {
+				return os.ReadFile(filepath.Clean(path))
+			},
+		})
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return sources, nil
+	return files, nil
+}
+
+// repositoryFiles returns the .proto files of a commit tree listed from dir. Their source paths are put under rootDir,
+// so that includes and ignores match the same way as for files on disk. dir is kept in the destination.
+func repositoryFiles(rootDir, dir string, files []repository.File) []protoResource {
+	resources := make([]protoResource, 0, len(files))
+
+	for i := range files {
+		f := &files[i]
+		if !strings.HasSuffix(f.Path, ".proto") {
+			continue
+		}
+
+		rel := filepath.FromSlash(path.Join(dir, f.Path))
+		resources = append(resources, protoResource{
+			source:       filepath.Join(rootDir, rel),
+			relativeDest: rel,
+			read:         f.Read,
+		})
+	}
+
+	return resources
+}
+
+// getSources filters the candidate files by the includes and ignores of the dependency.
+func (s *Resolver) getSources(dep config.ProtoDepDependency, protoRootDir string, candidates []protoResource) []protoResource {
+	sources := make([]protoResource, 0, len(candidates))
+
+	compiledIgnores := compileIgnoreToGlob(dep.Ignores)
+	compiledIncludes := compileIgnoreToGlob(dep.Includes)
+
+	hasIncludes := len(dep.Includes) > 0
+
+	for _, c := range candidates {
+		isIncludePath := s.isMatchPath(protoRootDir, c.source, dep.Includes, compiledIncludes)
+		isIgnorePath := s.isMatchPath(protoRootDir, c.source, dep.Ignores, compiledIgnores)
+
+		if hasIncludes && !isIncludePath {
+			logger.Info("skipped %s due to include setting", c.source)
+		} else if isIgnorePath {
+			logger.Info("skipped %s due to ignore setting", c.source)
+		} else {
+			sources = append(sources, c)
+		}
+	}
+
+	return sources
 }
 
 func compileIgnoreToGlob(ignores []string) []glob.Glob {
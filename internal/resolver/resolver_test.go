@@ -1,17 +1,29 @@
 package resolver
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
 	"github.com/n-r-w/protodep/internal/auth"
+	"github.com/n-r-w/protodep/internal/cache"
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/repository"
 )
 
 func TestSync(t *testing.T) {
@@ -22,16 +34,18 @@ func TestSync(t *testing.T) {
 	err = os.RemoveAll(dotProtoDir)
 	require.NoError(t, err)
 
-	pwd, err := os.Getwd()
-	fmt.Println(pwd)
-
+	// Resolve writes protodep.lock next to protodep.toml, so that the config is copied out of the source tree.
+	content, err := os.ReadFile(config.FileName)
 	require.NoError(t, err)
 
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, string(content))
+
 	outputRootDir := os.TempDir()
 
 	conf := Config{
 		HomeDir:   dotProtoDir,
-		TargetDir: pwd,
+		TargetDir: targetDir,
 		OutputDir: outputRootDir,
 	}
 
@@ -40,18 +54,18 @@ func TestSync(t *testing.T) {
 
 	httpsAuthProviderMock := auth.NewMockAuthProvider(c)
 	httpsAuthProviderMock.EXPECT().AuthMethod().Return(nil, nil).AnyTimes()
-	httpsAuthProviderMock.EXPECT().GetRepositoryURL("github.com/protocolbuffers/protobuf").Return("https://github.com/protocolbuffers/protobuf.git")
-	httpsAuthProviderMock.EXPECT().GetRepositoryURL("github.com/protodep/catalog").Return("https://github.com/protodep/catalog.git")
+	httpsAuthProviderMock.EXPECT().GetRepositoryURL("github.com/protocolbuffers/protobuf").Return("https://github.com/protocolbuffers/protobuf.git").AnyTimes()
+	httpsAuthProviderMock.EXPECT().GetRepositoryURL("github.com/protodep/catalog").Return("https://github.com/protodep/catalog.git").AnyTimes()
 
 	sshAuthProviderMock := auth.NewMockAuthProvider(c)
 	sshAuthProviderMock.EXPECT().AuthMethod().Return(nil, nil).AnyTimes()
-	sshAuthProviderMock.EXPECT().GetRepositoryURL("github.com/opensaasstudio/plasma").Return("https://github.com/opensaasstudio/plasma.git")
+	sshAuthProviderMock.EXPECT().GetRepositoryURL("github.com/opensaasstudio/plasma").Return("https://github.com/opensaasstudio/plasma.git").AnyTimes()
 
 	target, err := New(&conf, httpsAuthProviderMock, sshAuthProviderMock)
 	require.NoError(t, err)
 
 	// clone
-	err = target.Resolve(false)
+	err = target.Resolve(context.Background(), false)
 	require.NoError(t, err)
 
 	if !isFileExist(filepath.Join(outputRootDir, "proto/stream.proto")) {
@@ -94,7 +108,7 @@ func TestSync(t *testing.T) {
 	}
 
 	// fetch
-	err = target.Resolve(false)
+	err = target.Resolve(context.Background(), false)
 	require.NoError(t, err)
 }
 
@@ -132,3 +146,1567 @@ func TestIsAvailableSSH(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, notFound)
 }
+
+// fixtureRepo is a local git repository used as a remote dependency.
+type fixtureRepo struct {
+	t    *testing.T
+	dir  string
+	repo *git.Repository
+}
+
+func newFixtureRepo(t *testing.T) *fixtureRepo {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+
+	return &fixtureRepo{t: t, dir: dir, repo: repo}
+}
+
+func (f *fixtureRepo) URL() string {
+	return "file://" + filepath.ToSlash(f.dir)
+}
+
+// commit writes the files into the worktree and commits them.
+func (f *fixtureRepo) commit(files map[string]string) plumbing.Hash {
+	f.t.Helper()
+
+	wt, err := f.repo.Worktree()
+	require.NoError(f.t, err)
+
+	for name, content := range files {
+		require.NoError(f.t, writeFileWithDirectory(filepath.Join(f.dir, name), []byte(content), 0o644))
+		_, err = wt.Add(name)
+		require.NoError(f.t, err)
+	}
+
+	hash, err := wt.Commit("commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "protodep", Email: "protodep@example.com", When: time.Now()},
+	})
+	require.NoError(f.t, err)
+
+	return hash
+}
+
+// symlink stages a symlink at name pointing to target, for the next commit.
+func (f *fixtureRepo) symlink(name, target string) {
+	f.t.Helper()
+
+	require.NoError(f.t, os.MkdirAll(filepath.Dir(filepath.Join(f.dir, name)), 0o755))
+	require.NoError(f.t, os.Symlink(target, filepath.Join(f.dir, name)))
+	wt, err := f.repo.Worktree()
+	require.NoError(f.t, err)
+	_, err = wt.Add(name)
+	require.NoError(f.t, err)
+}
+
+// addSubmodule stages a submodule at path pointing to commit of url, for the next commit.
+func (f *fixtureRepo) addSubmodule(path, url string, commit plumbing.Hash) {
+	f.t.Helper()
+
+	gitmodules := fmt.Sprintf("[submodule %q]\n\tpath = %s\n\turl = %s\n", path, path, url)
+	require.NoError(f.t, os.WriteFile(filepath.Join(f.dir, ".gitmodules"), []byte(gitmodules), 0o644))
+	wt, err := f.repo.Worktree()
+	require.NoError(f.t, err)
+	_, err = wt.Add(".gitmodules")
+	require.NoError(f.t, err)
+
+	idx, err := f.repo.Storer.Index()
+	require.NoError(f.t, err)
+	idx.Entries = append(idx.Entries, &index.Entry{Name: path, Hash: commit, Mode: filemode.Submodule})
+	require.NoError(f.t, f.repo.Storer.SetIndex(idx))
+}
+
+func (f *fixtureRepo) tag(name string, hash plumbing.Hash) {
+	f.t.Helper()
+
+	_, err := f.repo.CreateTag(name, hash, nil)
+	require.NoError(f.t, err)
+}
+
+func writeProtodepToml(t *testing.T, dir, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "protodep.toml"), []byte(content), 0o644))
+}
+
+func newFixtureResolver(t *testing.T, conf *Config, urls map[string]string) *Resolver {
+	t.Helper()
+
+	c := gomock.NewController(t)
+
+	authProviderMock := auth.NewMockAuthProvider(c)
+	authProviderMock.EXPECT().AuthMethod().Return(nil, nil).AnyTimes()
+	for reponame, url := range urls {
+		authProviderMock.EXPECT().GetRepositoryURL(reponame).Return(url).AnyTimes()
+	}
+
+	target, err := New(conf, authProviderMock, authProviderMock)
+	require.NoError(t, err)
+
+	return target
+}
+
+func TestResolveLock(t *testing.T) {
+	remote := newFixtureRepo(t)
+	first := remote.commit(map[string]string{"proto/foo/v1/foo.proto": "v1"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/proto"
+  branch = "master"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 1)
+	require.Equal(t, first.String(), lock.Dependencies[0].Commit)
+	require.Equal(t, "refs/heads/master", lock.Dependencies[0].Ref)
+	require.Equal(t, remote.URL(), lock.Dependencies[0].URL)
+	require.Equal(t, []config.LockedFile{{
+		Path:   "foo/v1/foo.proto",
+		SHA256: "3bfc269594ef649228e9a74bab00f042efc91d5acc6fbee31a382e80d42388fe",
+	}}, lock.Dependencies[0].Files)
+
+	// A new upstream commit is ignored while the lock pins the first one.
+	remote.commit(map[string]string{"proto/foo/v1/foo.proto": "v2"})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+	content, err := os.ReadFile(filepath.Join(targetDir, "proto/foo/v1/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(content))
+
+	conf.Update = true
+	require.NoError(t, target.Resolve(context.Background(), false))
+	content, err = os.ReadFile(filepath.Join(targetDir, "proto/foo/v1/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(content))
+}
+
+func TestVerify(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{
+		"proto/foo/v1/foo.proto": "foo",
+		"proto/bar/v1/bar.proto": "bar",
+	})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/proto"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	err := target.Verify(context.Background())
+	require.ErrorIs(t, err, ErrOutOfDate)
+	require.Contains(t, err.Error(), "missing:    foo/v1/foo.proto")
+	require.Contains(t, err.Error(), "lock:       example.com/org/repo/proto is not locked")
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+	require.NoError(t, target.Verify(context.Background()))
+
+	outdir := filepath.Join(targetDir, "proto")
+	require.NoError(t, os.WriteFile(filepath.Join(outdir, "foo/v1/foo.proto"), []byte("changed"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(outdir, "bar/v1/bar.proto")))
+	require.NoError(t, os.WriteFile(filepath.Join(outdir, "extra.proto"), []byte("extra"), 0o644))
+
+	err = target.Verify(context.Background())
+	require.ErrorIs(t, err, ErrOutOfDate)
+	require.Equal(t, ErrOutOfDate.Error()+":\n"+
+		"missing:    bar/v1/bar.proto\n"+
+		"unexpected: extra.proto\n"+
+		"modified:   foo/v1/foo.proto", err.Error())
+}
+
+func TestLockURL(t *testing.T) {
+	// The lock doesn't depend on whether the machine clones over ssh or https.
+	require.Equal(t, "github.com/org/repo", lockURL("git@github.com:org/repo.git"))
+	require.Equal(t, "github.com/org/repo", lockURL("https://user@github.com/org/repo"))
+	require.Equal(t, "bitbucket.company.org:7999/scm/team/repo", lockURL("ssh://git@bitbucket.company.org:7999/scm/team/repo.git"))
+	require.Equal(t, "file:///srv/repo", lockURL("file:///srv/repo"))
+}
+
+func TestDiffLock(t *testing.T) {
+	locked := config.LockedDependency{Target: "example.com/org/repo", Commit: "8c1b", URL: "example.com/org/repo"}
+	lock := &config.ProtoDepLock{Dependencies: []config.LockedDependency{locked}}
+
+	resolved := locked
+	resolved.URL = "mirror.example.com/org/repo"
+	require.Equal(t, []string{
+		"lock:       example.com/org/repo: url example.com/org/repo locked, mirror.example.com/org/repo resolved",
+	}, diffLock(lock, &config.ProtoDepLock{Dependencies: []config.LockedDependency{resolved}}))
+
+	resolved = locked
+	resolved.Commit = "9d2c"
+	resolved.Ref = "refs/heads/main"
+	require.Equal(t, []string{
+		"lock:       example.com/org/repo: commit 8c1b locked, 9d2c resolved, ref none locked, refs/heads/main resolved",
+	}, diffLock(lock, &config.ProtoDepLock{Dependencies: []config.LockedDependency{resolved}}))
+
+	require.Empty(t, diffLock(lock, &config.ProtoDepLock{Dependencies: []config.LockedDependency{locked}}))
+}
+
+func TestResolveCleanupLocked(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{"foo.proto": "foo"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  protocol = "https"
+`)
+
+	homeDir := t.TempDir()
+	conf := Config{
+		HomeDir:     homeDir,
+		TargetDir:   targetDir,
+		OutputDir:   targetDir,
+		LockTimeout: 200 * time.Millisecond,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	// A repository used by another process isn't removed under it.
+	repoDir := filepath.Join(homeDir, ".protodep/example.com/org/repo")
+	lock, err := cache.LockRepository(context.Background(), repoDir, 0)
+	require.NoError(t, err)
+	require.ErrorContains(t, target.Resolve(context.Background(), true), "timed out")
+	require.DirExists(t, repoDir)
+	lock.Unlock()
+
+	require.NoError(t, target.Resolve(context.Background(), true))
+	require.FileExists(t, filepath.Join(targetDir, "proto/foo.proto"))
+}
+
+func TestOpenHoldsLock(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{"foo.proto": "foo"})
+
+	gitrepo := repository.NewGit(t.TempDir(), config.ProtoDepDependency{URL: remote.URL()}, nil)
+	opened, err := gitrepo.Open(context.Background())
+	require.NoError(t, err)
+
+	// The cached repository can't be removed or fetched by others while its files are read.
+	_, err = cache.LockRepository(context.Background(), gitrepo.RootDir(), 200*time.Millisecond)
+	require.ErrorContains(t, err, "timed out")
+	content, err := opened.ReadFile("foo.proto")
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(content))
+
+	opened.Close()
+	lock, err := cache.LockRepository(context.Background(), gitrepo.RootDir(), 200*time.Millisecond)
+	require.NoError(t, err)
+	lock.Unlock()
+}
+
+func TestResolveKeepsOutdirOnError(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{"proto/foo/v1/foo.proto": "foo"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/proto"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{
+		"example.com/org/repo":    remote.URL(),
+		"example.com/org/missing": "file://" + filepath.ToSlash(filepath.Join(t.TempDir(), "missing")),
+	})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/proto"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/missing/proto"
+  protocol = "https"
+`)
+
+	require.Error(t, target.Resolve(context.Background(), false))
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "proto/foo/v1/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(content))
+
+	entries, err := os.ReadDir(targetDir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{"proto", "protodep.toml", "protodep.lock"}, names)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, target.Resolve(ctx, false), context.Canceled)
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/foo/v1/foo.proto")))
+}
+
+func TestResolveOutdirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+
+	localDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(localDir, "foo.proto"), []byte("foo"), 0o644))
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  local_folder = "`+filepath.ToSlash(localDir)+`"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, nil)
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+	info, err := os.Stat(filepath.Join(targetDir, "proto"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+
+	// The mode of an existing proto_outdir is kept.
+	require.NoError(t, os.Chmod(filepath.Join(targetDir, "proto"), 0o755))
+	require.NoError(t, target.Resolve(context.Background(), false))
+	info, err = os.Stat(filepath.Join(targetDir, "proto"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+}
+
+func TestGroupByRepository(t *testing.T) {
+	deps := []config.ProtoDepDependency{
+		{Target: "github.com/org/a/foo"},
+		{Target: "github.com/org/b"},
+		{LocalFolder: "./api"},
+		{Target: "github.com/org/a/bar"},
+		{LocalFolder: "./api2"},
+	}
+
+	require.Equal(t, [][]int{{0, 3}, {1}, {2}, {4}}, groupByRepository(deps))
+}
+
+func TestResolveJobs(t *testing.T) {
+	first := newFixtureRepo(t)
+	first.commit(map[string]string{
+		"foo/v1/foo.proto": "foo",
+		"bar/v1/bar.proto": "bar",
+	})
+	second := newFixtureRepo(t)
+	second.commit(map[string]string{"baz/v1/baz.proto": "baz"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/first/foo"
+  path = "foo"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/second"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/first/bar"
+  path = "bar"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+		Jobs:      4,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{
+		"example.com/org/first":  first.URL(),
+		"example.com/org/second": second.URL(),
+	})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 3)
+	require.Equal(t, "example.com/org/first/foo", lock.Dependencies[0].Target)
+	require.Equal(t, "example.com/org/second", lock.Dependencies[1].Target)
+	require.Equal(t, "example.com/org/first/bar", lock.Dependencies[2].Target)
+
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/foo/v1/foo.proto")))
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/bar/v1/bar.proto")))
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/baz/v1/baz.proto")))
+}
+
+func TestResolveRevisionsOfOneRepository(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.tag("v1.0.0", remote.commit(map[string]string{"proto/foo.proto": "v1"}))
+	remote.tag("v2.0.0", remote.commit(map[string]string{"proto/foo.proto": "v2"}))
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/proto"
+  revision = "v1.0.0"
+  path = "v1"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/repo/proto"
+  revision = "v2.0.0"
+  path = "v2"
+  protocol = "https"
+`)
+
+	homeDir := t.TempDir()
+	conf := Config{
+		HomeDir:   homeDir,
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	for _, version := range []string{"v1", "v2"} {
+		content, err := os.ReadFile(filepath.Join(targetDir, "proto", version, "foo.proto"))
+		require.NoError(t, err)
+		require.Equal(t, version, string(content))
+	}
+
+	// The cache is a bare repository without a worktree.
+	require.False(t, isFileExist(filepath.Join(homeDir, ".protodep/example.com/org/repo/proto")))
+	require.True(t, isFileExist(filepath.Join(homeDir, ".protodep/example.com/org/repo/HEAD")))
+}
+
+func TestResolveTransitive(t *testing.T) {
+	c := newFixtureRepo(t)
+	c.tag("v1.0.0", c.commit(map[string]string{"c.proto": "c1"}))
+	c.tag("v1.2.0", c.commit(map[string]string{
+		"c.proto": "c2",
+		// A cycle back to the top-level dependency is skipped.
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/a"
+  protocol = "https"
+`,
+	}))
+
+	b := newFixtureRepo(t)
+	b.tag("v1.0.0", b.commit(map[string]string{
+		"b.proto": "b",
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/c"
+  revision = "v1.2.0"
+  protocol = "https"
+`,
+	}))
+
+	a := newFixtureRepo(t)
+	a.commit(map[string]string{
+		"a.proto": "a",
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/b"
+  revision = "v1.0.0"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/c"
+  revision = "v1.0.0"
+  protocol = "https"
+`,
+	})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  name = "api"
+  target = "example.com/org/a"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{
+		"example.com/org/a": a.URL(),
+		"example.com/org/b": b.URL(),
+		"example.com/org/c": c.URL(),
+	})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "proto/c.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "c2", string(content))
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/b.proto")))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 3)
+	require.Equal(t, "example.com/org/a", lock.Dependencies[0].Target)
+	require.Empty(t, lock.Dependencies[0].Via)
+	require.Equal(t, "example.com/org/b", lock.Dependencies[1].Target)
+	require.Equal(t, []string{"api"}, lock.Dependencies[1].Via)
+	require.Equal(t, "example.com/org/c", lock.Dependencies[2].Target)
+	require.Equal(t, "v1.2.0", lock.Dependencies[2].Revision)
+	require.Equal(t, []string{"api", "example.com/org/b"}, lock.Dependencies[2].Via)
+
+	require.NoError(t, target.Verify(context.Background()))
+}
+
+func TestResolveTransitiveReplaced(t *testing.T) {
+	d := newFixtureRepo(t)
+	d.commit(map[string]string{"d.proto": "d"})
+
+	c := newFixtureRepo(t)
+	c.tag("v1.0.0", c.commit(map[string]string{
+		"c.proto": "c1",
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/d"
+  protocol = "https"
+`,
+	}))
+	// v2.0.0 doesn't need d anymore.
+	c.tag("v2.0.0", c.commit(map[string]string{"c.proto": "c2", "protodep.toml": `proto_outdir = "./proto"`}))
+
+	x := newFixtureRepo(t)
+	x.commit(map[string]string{
+		"x.proto": "x",
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/c"
+  revision = "v2.0.0"
+  protocol = "https"
+`,
+	})
+
+	a := newFixtureRepo(t)
+	a.commit(map[string]string{
+		"a.proto": "a",
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/c"
+  revision = "v1.0.0"
+  protocol = "https"
+`,
+	})
+
+	b := newFixtureRepo(t)
+	b.commit(map[string]string{
+		"b.proto": "b",
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/x"
+  protocol = "https"
+`,
+	})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/a"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/b"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{
+		"example.com/org/a": a.URL(),
+		"example.com/org/b": b.URL(),
+		"example.com/org/c": c.URL(),
+		"example.com/org/d": d.URL(),
+		"example.com/org/x": x.URL(),
+	})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "proto/c.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "c2", string(content))
+	// d was only required by c v1.0.0, which c v2.0.0 replaced.
+	require.False(t, isFileExist(filepath.Join(targetDir, "proto/d.proto")))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	targets := make([]string, 0, len(lock.Dependencies))
+	for _, locked := range lock.Dependencies {
+		targets = append(targets, locked.Target)
+	}
+	require.Equal(t, []string{"example.com/org/a", "example.com/org/b", "example.com/org/x", "example.com/org/c"}, targets)
+	require.Equal(t, []string{"example.com/org/b", "example.com/org/x"}, lock.Dependencies[3].Via)
+}
+
+func TestResolveDirectSharingTarget(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{"a/a.proto": "a", "b/b.proto": "b"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  includes = ["/a"]
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  includes = ["/b"]
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/a/a.proto")))
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/b/b.proto")))
+}
+
+func TestResolveTransitiveUnsafe(t *testing.T) {
+	b := newFixtureRepo(t)
+	b.commit(map[string]string{"b.proto": "b"})
+
+	a := newFixtureRepo(t)
+	a.commit(map[string]string{
+		"a.proto": "a",
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  url = "` + b.dir + `"
+`,
+	})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/a"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/a": a.URL()})
+
+	// A local repository required by a dependency is skipped.
+	require.NoError(t, target.Resolve(context.Background(), false))
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/a.proto")))
+	require.False(t, isFileExist(filepath.Join(targetDir, "proto/b.proto")))
+
+	// A dependency can't make its own dependencies write outside proto_outdir.
+	a.commit(map[string]string{"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/b"
+  path = "../../escaped"
+  protocol = "https"
+`})
+	conf.Update = true
+	err := target.Resolve(context.Background(), false)
+	require.ErrorContains(t, err, "path ../../escaped must be inside proto_outdir")
+}
+
+func TestResolveTransitiveCredentials(t *testing.T) {
+	b := newFixtureRepo(t)
+	b.commit(map[string]string{"b.proto": "b"})
+
+	a := newFixtureRepo(t)
+	a.commit(map[string]string{
+		"a.proto": "a",
+		"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/b"
+  protocol = "https"
+  username_env = "PROTODEP_TEST_USERNAME"
+  password_env = "PROTODEP_TEST_SECRET"
+`,
+	})
+	t.Setenv("PROTODEP_TEST_USERNAME", "user")
+	t.Setenv("PROTODEP_TEST_SECRET", "secret")
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/a"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{
+		"example.com/org/a": a.URL(),
+		"example.com/org/b": b.URL(),
+	})
+
+	// The environment variables named by a dependency are ignored, b is fetched with the auth provider of the machine.
+	require.NoError(t, target.Resolve(context.Background(), false))
+	require.True(t, isFileExist(filepath.Join(targetDir, "proto/b.proto")))
+}
+
+func TestResolveTransitiveVersions(t *testing.T) {
+	c := newFixtureRepo(t)
+	c.tag("v1.2.0", c.commit(map[string]string{"c.proto": "1.2.0"}))
+	c.tag("v1.4.3", c.commit(map[string]string{"c.proto": "1.4.3"}))
+	c.tag("v1.5.0", c.commit(map[string]string{"c.proto": "1.5.0"}))
+	c.tag("v2.0.0", c.commit(map[string]string{"c.proto": "2.0.0"}))
+
+	requiring := func(version string) *fixtureRepo {
+		r := newFixtureRepo(t)
+		r.commit(map[string]string{"protodep.toml": `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/c"
+  version = "` + version + `"
+  protocol = "https"
+`})
+		return r
+	}
+	a, b := requiring("^1.2"), requiring("~1.4")
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/a"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/b"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{
+		"example.com/org/a": a.URL(),
+		"example.com/org/b": b.URL(),
+		"example.com/org/c": c.URL(),
+	})
+
+	// The highest version matching both constraints is used, and the lock keeps it on the next run.
+	for range 2 {
+		require.NoError(t, target.Resolve(context.Background(), false))
+		content, err := os.ReadFile(filepath.Join(targetDir, "proto/c.proto"))
+		require.NoError(t, err)
+		require.Equal(t, "1.4.3", string(content))
+	}
+	require.NoError(t, target.Verify(context.Background()))
+}
+
+func TestPickRequirement(t *testing.T) {
+	direct := &pendingDependency{dep: config.ProtoDepDependency{Target: "example.com/org/c", Branch: "main"}}
+	v1 := &pendingDependency{dep: config.ProtoDepDependency{Target: "example.com/org/c", Revision: "v1.0.0"}, via: []string{"a"}}
+	v2 := &pendingDependency{dep: config.ProtoDepDependency{Target: "example.com/org/c", Revision: "v2.1.0"}, via: []string{"b"}}
+	branch := &pendingDependency{dep: config.ProtoDepDependency{Target: "example.com/org/c", Branch: "dev"}, via: []string{"b"}}
+
+	chosen, err := pickRequirement(direct, v2)
+	require.NoError(t, err)
+	require.Same(t, direct, chosen)
+
+	chosen, err = pickRequirement(v1, v2)
+	require.NoError(t, err)
+	require.Same(t, v2, chosen)
+
+	chosen, err = pickRequirement(v2, v1)
+	require.NoError(t, err)
+	require.Same(t, v2, chosen)
+
+	_, err = pickRequirement(v1, branch)
+	require.EqualError(t, err, "conflicting requirements for example.com/org/c: revision v1.0.0 via a and branch dev via b")
+
+	caret12 := &pendingDependency{dep: config.ProtoDepDependency{Target: "example.com/org/c", Version: "^1.2"}, via: []string{"a"}}
+	caret14 := &pendingDependency{dep: config.ProtoDepDependency{Target: "example.com/org/c", Version: "^1.4 || ^2"}, via: []string{"b"}}
+
+	chosen, err = pickRequirement(caret12, caret14)
+	require.NoError(t, err)
+	require.Equal(t, "^1.2, ^1.4 || ^1.2, ^2", chosen.dep.Version)
+	require.Equal(t, []string{"b"}, chosen.via)
+
+	// A revision matching the constraint satisfies both requirements.
+	chosen, err = pickRequirement(caret14, v2)
+	require.NoError(t, err)
+	require.Same(t, v2, chosen)
+
+	_, err = pickRequirement(caret12, v2)
+	require.EqualError(t, err, "conflicting requirements for example.com/org/c: version ^1.2 via a and revision v2.1.0 via b")
+}
+
+func TestIntersectVersions(t *testing.T) {
+	c, err := semver.NewConstraint(intersectVersions("^1.2 || ^3", ">=1.4.0 || >=3.1.0"))
+	require.NoError(t, err)
+
+	for version, want := range map[string]bool{"1.3.0": false, "1.4.1": true, "2.0.0": false, "3.0.0": true, "4.0.0": false} {
+		require.Equal(t, want, c.Check(semver.MustParse(version)), version)
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.tag("v1.3.0", remote.commit(map[string]string{"foo.proto": "1.3.0"}))
+	remote.tag("v1.4.0", remote.commit(map[string]string{"foo.proto": "1.4.0"}))
+	remote.tag("v1.4.2", remote.commit(map[string]string{"foo.proto": "1.4.2"}))
+	remote.tag("not-a-version", remote.commit(map[string]string{"foo.proto": "other"}))
+	remote.tag("v2.0.0", remote.commit(map[string]string{"foo.proto": "2.0.0"}))
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  version = "^1.4"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "1.4.2", string(content))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, "^1.4", lock.Dependencies[0].Version)
+	require.Equal(t, "refs/tags/v1.4.2", lock.Dependencies[0].Ref)
+
+	remote.tag("v1.5.0", remote.commit(map[string]string{"foo.proto": "1.5.0"}))
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+	content, err = os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "1.4.2", string(content))
+
+	conf.Update = true
+	require.NoError(t, target.Resolve(context.Background(), false))
+	content, err = os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "1.5.0", string(content))
+}
+
+func TestOutdated(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.tag("v1.0.0", remote.commit(map[string]string{"foo.proto": "1.0.0"}))
+	first := remote.commit(map[string]string{"foo.proto": "first"})
+	remote.tag("release-1", first)
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  branch = "master"
+  path = "branch"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  revision = "v1.0.0"
+  path = "tag"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  version = "^1.0"
+  path = "version"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  revision = "release-1"
+  path = "release"
+  protocol = "https"
+
+[[dependencies]]
+  local_folder = "./api"
+`)
+	require.NoError(t, os.MkdirAll(filepath.Join(targetDir, "api"), 0o750))
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(targetDir))
+	defer os.Chdir(wd)
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	latest := remote.commit(map[string]string{"foo.proto": "latest"})
+	remote.tag("v1.1.0", latest)
+	major := remote.commit(map[string]string{"foo.proto": "major"})
+	remote.tag("v2.0.0", major)
+
+	outdated, err := target.Outdated(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []OutdatedDependency{
+		{
+			Target:      "example.com/org/repo",
+			Kind:        OutdatedKindBranch,
+			Requirement: "master",
+			Current:     first.String(),
+			Wanted:      major.String(),
+			Latest:      major.String(),
+			Outdated:    true,
+		},
+		{
+			Target:      "example.com/org/repo",
+			Kind:        OutdatedKindTag,
+			Requirement: "v1.0.0",
+			Current:     "v1.0.0",
+			Wanted:      "v1.0.0",
+			Latest:      "v2.0.0",
+			Outdated:    true,
+		},
+		{
+			Target:      "example.com/org/repo",
+			Kind:        OutdatedKindVersion,
+			Requirement: "^1.0",
+			Current:     "v1.0.0",
+			Wanted:      "v1.1.0",
+			Latest:      "v2.0.0",
+			Outdated:    true,
+		},
+		{
+			Target:      "example.com/org/repo",
+			Kind:        OutdatedKindTag,
+			Requirement: "release-1",
+			Current:     "release-1",
+			Wanted:      "release-1",
+		},
+	}, outdated)
+
+	// A version constraint is up to date with the newest matching tag, even if a newer major version exists.
+	require.NoError(t, target.Update(context.Background(), nil))
+	outdated, err = target.Outdated(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "v1.1.0", outdated[2].Current)
+	require.False(t, outdated[2].Outdated)
+}
+
+func TestResolveShallow(t *testing.T) {
+	remote := newFixtureRepo(t)
+	first := remote.commit(map[string]string{"foo.proto": "first"})
+	remote.commit(map[string]string{"foo.proto": "second"})
+	remote.commit(map[string]string{"other.proto": "other"})
+	third := remote.commit(map[string]string{"foo.proto": "third"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  branch = "master"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	cache, err := git.PlainOpen(filepath.Join(conf.HomeDir, ".protodep", "example.com/org/repo"))
+	require.NoError(t, err)
+	_, err = cache.CommitObject(third)
+	require.NoError(t, err)
+	_, err = cache.CommitObject(first)
+	require.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	// A commit pinned below the shallow history deepens the cache.
+	dep := config.NewDependency(targetDir)
+	lock, err := dep.LoadLock()
+	require.NoError(t, err)
+	lock.Dependencies[0].Commit = first.String()
+	require.NoError(t, dep.SaveLock(lock))
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "first", string(content))
+}
+
+func TestResolveExtraPaths(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{
+		"src/foo/foo.proto":         "foo",
+		"third_party/bar/bar.proto": "bar",
+		"docs/example.proto":        "example",
+	})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/src"
+  branch = "master"
+  protocol = "https"
+  extra_paths = ["third_party/bar"]
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 1)
+
+	var paths []string
+	for _, f := range lock.Dependencies[0].Files {
+		paths = append(paths, f.Path)
+	}
+	require.Equal(t, []string{"foo/foo.proto", "third_party/bar/bar.proto"}, paths)
+
+	// Includes match the files of extra_paths by their path from the repository root.
+	remote.commit(map[string]string{"src/other/other.proto": "other", "third_party/bar/skipped.proto": "skipped"})
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/src"
+  branch = "master"
+  protocol = "https"
+  extra_paths = ["third_party/bar"]
+  includes = ["/foo", "/third_party/bar/bar.proto"]
+`)
+	conf.Update = true
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	lock, err = config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	paths = paths[:0]
+	for _, f := range lock.Dependencies[0].Files {
+		paths = append(paths, f.Path)
+	}
+	require.Equal(t, []string{"foo/foo.proto", "third_party/bar/bar.proto"}, paths)
+}
+
+func TestResolveSymlinks(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.symlink("proto/c.proto", "../common/c.proto")
+	remote.symlink("proto/chained.proto", "c.proto")
+	remote.symlink("escaping/x.proto", "../../outside.proto")
+	remote.commit(map[string]string{"common/c.proto": "common"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/proto"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": remote.URL()})
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	// Symlinks are followed within the commit, as in a checkout.
+	for _, name := range []string{"c.proto", "chained.proto"} {
+		content, err := os.ReadFile(filepath.Join(targetDir, "proto", name))
+		require.NoError(t, err)
+		require.Equal(t, "common", string(content), name)
+	}
+
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo/escaping"
+  protocol = "https"
+`)
+	err := target.Resolve(context.Background(), false)
+	require.ErrorContains(t, err, "symlink escaping/x.proto -> ../../outside.proto leads outside the repository")
+}
+
+func TestResolveRemoteChanged(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{"foo.proto": "remote"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	cachePath := filepath.Join(conf.HomeDir, ".protodep", "example.com/org/repo")
+	origin := func() string {
+		t.Helper()
+		cache, err := git.PlainOpen(cachePath)
+		require.NoError(t, err)
+		remote, err := cache.Remote(git.DefaultRemoteName)
+		require.NoError(t, err)
+		return remote.Config().URLs[0]
+	}
+	resolve := func(url string) string {
+		t.Helper()
+		target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/repo": url})
+		require.NoError(t, target.Resolve(context.Background(), false))
+		content, err := os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	require.Equal(t, "remote", resolve(remote.URL()))
+	require.Equal(t, remote.URL(), origin())
+
+	// The same repository under another protocol.
+	require.Equal(t, "remote", resolve(remote.dir))
+	require.Equal(t, remote.dir, origin())
+
+	// A mirror shares the history of the cache.
+	mirror := t.TempDir()
+	_, err := git.PlainClone(mirror, true, &git.CloneOptions{URL: remote.URL()})
+	require.NoError(t, err)
+	require.Equal(t, "remote", resolve("file://"+filepath.ToSlash(mirror)))
+	require.Equal(t, "file://"+filepath.ToSlash(mirror), origin())
+
+	// An unrelated repository replaces the cache.
+	unrelated := newFixtureRepo(t)
+	unrelated.commit(map[string]string{"foo.proto": "unrelated"})
+	conf.Update = true
+	require.Equal(t, "unrelated", resolve(unrelated.URL()))
+	require.Equal(t, unrelated.URL(), origin())
+}
+
+func TestResolveOffline(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{"foo.proto": "cached"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  branch = "master"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	urls := map[string]string{
+		"example.com/org/repo":  remote.URL(),
+		"example.com/org/other": "file:///nonexistent",
+	}
+	target := newFixtureResolver(t, &conf, urls)
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	// Without the remote, branches resolve from the cached references.
+	require.NoError(t, os.RemoveAll(remote.dir))
+	conf.Offline = true
+	conf.Update = true
+	require.NoError(t, target.Resolve(context.Background(), false))
+	content, err := os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "cached", string(content))
+
+	// Every dependency missing in the cache is reported.
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  branch = "dev"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/other"
+  protocol = "https"
+`)
+	err = target.Resolve(context.Background(), false)
+	require.ErrorIs(t, err, repository.ErrNotCached)
+	require.ErrorContains(t, err, "example.com/org/repo: branch dev is not cached")
+	require.ErrorContains(t, err, "example.com/org/other: repository example.com/org/other is not cached")
+
+	// A commit pinned by the lock must be cached too.
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/repo"
+  branch = "master"
+  protocol = "https"
+`)
+	dep := config.NewDependency(targetDir)
+	lock, err := dep.LoadLock()
+	require.NoError(t, err)
+	lock.Dependencies[0].Commit = "0123456789012345678901234567890123456789"
+	require.NoError(t, dep.SaveLock(lock))
+
+	conf.Update = false
+	err = target.Resolve(context.Background(), false)
+	require.ErrorIs(t, err, repository.ErrNotCached)
+	require.ErrorContains(t, err, "commit 0123456789012345678901234567890123456789 locked in protodep.lock is not cached")
+
+	// prefer-offline fetches, but falls back to the cache if the remote is gone.
+	conf.Offline = false
+	conf.PreferOffline = true
+	conf.Update = true
+	require.NoError(t, target.Resolve(context.Background(), false))
+	content, err = os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "cached", string(content))
+}
+
+func TestResolveLocalURL(t *testing.T) {
+	root := t.TempDir()
+	targetDir := filepath.Join(root, "project")
+	require.NoError(t, os.MkdirAll(targetDir, 0o750))
+
+	dir := filepath.Join(root, "repos/api")
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	local := &fixtureRepo{t: t, dir: dir, repo: repo}
+	first := local.commit(map[string]string{"proto/api.proto": "v1"})
+	local.tag("v1.0.0", first)
+	local.commit(map[string]string{"proto/api.proto": "v2"})
+
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  url = "../repos/api"
+  subdir = "proto"
+  version = "^1.0"
+  path = "tagged"
+
+[[dependencies]]
+  url = "`+local.URL()+`"
+  subdir = "proto"
+  path = "branch"
+
+[[dependencies]]
+  url = "`+local.dir+`"
+  revision = "`+first.String()+`"
+  path = "pinned"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	// No auth provider is needed for local repositories.
+	target, err := New(&conf, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	for file, want := range map[string]string{
+		"proto/tagged/api.proto":       "v1",
+		"proto/branch/api.proto":       "v2",
+		"proto/pinned/proto/api.proto": "v1",
+	} {
+		content, err := os.ReadFile(filepath.Join(targetDir, file))
+		require.NoError(t, err)
+		require.Equal(t, want, string(content), file)
+	}
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, "../repos/api", lock.Dependencies[0].URL)
+	require.Equal(t, "refs/tags/v1.0.0", lock.Dependencies[0].Ref)
+	require.Equal(t, "refs/heads/master", lock.Dependencies[1].Ref)
+
+	// A relative url shares the cache with the absolute path of the repository, inside the cache directory.
+	entries, err := cache.List(target.protodepDir())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.True(t, filepath.IsLocal(filepath.FromSlash(entries[0].Repository)), entries[0].Repository)
+	require.True(t, strings.HasPrefix(entries[0].Path, target.protodepDir()+string(filepath.Separator)), entries[0].Path)
+
+	require.NoError(t, target.Verify(context.Background()))
+}
+
+func TestGetRepositoryGitProtocol(t *testing.T) {
+	conf := Config{HomeDir: t.TempDir(), TargetDir: t.TempDir()}
+	// No auth provider is needed, the git protocol has no authentication.
+	target, err := New(&conf, nil, nil)
+	require.NoError(t, err)
+
+	gitrepo, err := target.getRepository(config.ProtoDepDependency{
+		URL:    "git://example.com:9418/org/repo.git",
+		Target: "example.com/org/repo",
+	}, t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, "example.com/org/repo", gitrepo.Repository())
+}
+
+func TestResolveSubmodules(t *testing.T) {
+	reposDir := t.TempDir()
+
+	newRepo := func(name string) *fixtureRepo {
+		dir := filepath.Join(reposDir, name)
+		repo, err := git.PlainInit(dir, false)
+		require.NoError(t, err)
+		return &fixtureRepo{t: t, dir: dir, repo: repo}
+	}
+
+	common := newRepo("common")
+	recorded := common.commit(map[string]string{"api/common.proto": "recorded"})
+	common.commit(map[string]string{"api/common.proto": "latest"})
+
+	api := newRepo("api")
+	// A relative url is relative to the url of the parent.
+	api.addSubmodule("proto/third_party/common", "../common", recorded)
+	api.commit(map[string]string{"proto/api.proto": "api"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  url = "`+api.URL()+`"
+  subdir = "proto"
+  submodules = true
+  path = "all"
+
+[[dependencies]]
+  url = "`+api.URL()+`"
+  subdir = "proto/third_party/common/api"
+  submodules = true
+  path = "inside"
+
+[[dependencies]]
+  url = "`+api.URL()+`"
+  subdir = "proto"
+  path = "without"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target, err := New(&conf, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	for file, want := range map[string]string{
+		"proto/all/api.proto":                           "api",
+		"proto/all/third_party/common/api/common.proto": "recorded",
+		"proto/inside/common.proto":                     "recorded",
+		"proto/without/api.proto":                       "api",
+	} {
+		content, err := os.ReadFile(filepath.Join(targetDir, file))
+		require.NoError(t, err)
+		require.Equal(t, want, string(content), file)
+	}
+	require.False(t, isFileExist(filepath.Join(targetDir, "proto/without/third_party/common/api/common.proto")))
+}
+
+func TestSubmoduleDependency(t *testing.T) {
+	dep := config.ProtoDepDependency{
+		Target:      "gitlab.example.com/org/api",
+		UsernameEnv: "GITLAB_USERNAME",
+		PasswordEnv: "GITLAB_TOKEN",
+		Depth:       5,
+	}
+
+	subDep, err := submoduleDependency(dep, repository.Submodule{Path: "third_party/common", URL: "https://gitlab.example.com/org/common.git"})
+	require.NoError(t, err)
+	require.Equal(t, config.ProtoDepDependency{
+		Name:        "gitlab.example.com/org/api/third_party/common",
+		URL:         "https://gitlab.example.com/org/common.git",
+		UsernameEnv: "GITLAB_USERNAME",
+		PasswordEnv: "GITLAB_TOKEN",
+		Depth:       5,
+	}, subDep)
+
+	// The credentials of dep are not sent to another host.
+	subDep, err = submoduleDependency(dep, repository.Submodule{Path: "googleapis", URL: "https://other.example.com/googleapis.git"})
+	require.NoError(t, err)
+	require.Empty(t, subDep.UsernameEnv)
+	require.Empty(t, subDep.PasswordEnv)
+
+	for _, local := range []string{"file:///etc/repo", "/srv/git/repo"} {
+		_, err = submoduleDependency(dep, repository.Submodule{Path: "local", URL: local})
+		require.ErrorContains(t, err, "local url "+local+" of a remote repository is not allowed")
+	}
+
+	// A local repository may have local submodules.
+	_, err = submoduleDependency(config.ProtoDepDependency{URL: "/srv/git/api"}, repository.Submodule{Path: "local", URL: "/srv/git/common"})
+	require.NoError(t, err)
+}
+
+func TestResolveDefaultBranch(t *testing.T) {
+	remote := newFixtureRepo(t)
+	remote.commit(map[string]string{"foo.proto": "stale master"})
+	// The default branch is the one HEAD of the remote points to, not master.
+	require.NoError(t, remote.repo.Storer.SetReference(
+		plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("trunk"))))
+	trunk := remote.commit(map[string]string{"foo.proto": "trunk"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  url = "`+remote.URL()+`"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target, err := New(&conf, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	content, err := os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "trunk", string(content))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, "refs/heads/trunk", lock.Dependencies[0].Ref)
+	require.Equal(t, trunk.String(), lock.Dependencies[0].Commit)
+
+	// The default branch is kept in the cache for resolving offline.
+	require.NoError(t, os.RemoveAll(remote.dir))
+	conf.Offline = true
+	conf.Update = true
+	require.NoError(t, target.Resolve(context.Background(), false))
+	content, err = os.ReadFile(filepath.Join(targetDir, "proto/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "trunk", string(content))
+}
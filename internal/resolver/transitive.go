@@ -0,0 +1,256 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+	"github.com/n-r-w/protodep/internal/repository"
+)
+
+// pendingDependency is a dependency to resolve together with the chain of dependencies that required it.
+type pendingDependency struct {
+	dep config.ProtoDepDependency
+	// via lists the names of the dependencies that pulled the dependency in, starting from protodep.toml.
+	// It is empty for direct dependencies.
+	via []string
+	// targets are the targets of the dependencies in via.
+	targets []string
+	// key identifies the requirement and the chain that led to it, so that it is recognized when resolving again.
+	key string
+}
+
+// dependencyGraph discovers transitive dependencies level by level and picks one requirement per dependency.
+type dependencyGraph struct {
+	pending []*pendingDependency
+	// byKey is the requirement chosen for a target and path, which transitive requirements are checked against.
+	// Direct dependencies are never dropped, even if several of them share a key.
+	byKey map[string]*pendingDependency
+	// superseded are the keys of the requirements whose own dependencies are ignored, since another requirement
+	// replaced them in a previous run.
+	superseded map[string]bool
+}
+
+func newDependencyGraph(deps []config.ProtoDepDependency, superseded map[string]bool) *dependencyGraph {
+	g := &dependencyGraph{
+		pending:    make([]*pendingDependency, 0, len(deps)),
+		byKey:      make(map[string]*pendingDependency, len(deps)),
+		superseded: superseded,
+	}
+
+	for i, dep := range deps {
+		p := &pendingDependency{dep: dep, key: strconv.Itoa(i)}
+		g.pending = append(g.pending, p)
+		if _, ok := g.byKey[dependencyKey(&dep)]; dep.Target != "" && !ok {
+			g.byKey[dependencyKey(&dep)] = p
+		}
+	}
+
+	return g
+}
+
+// next returns the transitive dependencies declared by the resolved ones that have to be resolved yet.
+func (g *dependencyGraph) next(level []*resolvedDependency) ([]*pendingDependency, error) {
+	var next []*pendingDependency
+
+	for _, r := range level {
+		if len(r.nested) == 0 || g.superseded[r.pending.key] {
+			continue
+		}
+
+		via := append(slices.Clone(r.pending.via), r.dep.DisplayName())
+		targets := append(slices.Clone(r.pending.targets), r.dep.Target)
+		for _, dep := range r.nested {
+			if dep.Target == "" {
+				logger.Warn("skipped local_folder %s required by %s", dep.LocalFolder, strings.Join(via, " -> "))
+				continue
+			}
+			if dep.URL != "" && isLocalURL(dep.URL) {
+				logger.Warn("skipped local url %s required by %s", dep.URL, strings.Join(via, " -> "))
+				continue
+			}
+			if dep.UsernameEnv != "" || dep.PasswordEnv != "" {
+				// A repository must not choose the environment variables sent as credentials to a host it names.
+				logger.Warn("ignored username_env and password_env of %s required by %s",
+					dep.DisplayName(), strings.Join(via, " -> "))
+				dep.UsernameEnv, dep.PasswordEnv = "", ""
+			}
+			if dep.Path != "" && !config.Inside(dep.Path) {
+				return nil, fmt.Errorf("%s required by %s: path %s must be inside proto_outdir",
+					dep.DisplayName(), strings.Join(via, " -> "), dep.Path)
+			}
+			if slices.Contains(targets, dep.Target) {
+				logger.Warn("skipped dependency cycle %s -> %s", strings.Join(via, " -> "), dep.DisplayName())
+				continue
+			}
+
+			key := dependencyKey(&dep)
+			candidate := &pendingDependency{
+				dep:     dep,
+				via:     via,
+				targets: targets,
+				key:     r.pending.key + " > " + key + "|" + dep.Requirement(),
+			}
+
+			existing, ok := g.byKey[key]
+			if !ok {
+				logger.Info("%s is required by %s", dep.DisplayName(), strings.Join(via, " -> "))
+				g.byKey[key] = candidate
+				next = append(next, candidate)
+				continue
+			}
+
+			chosen, err := pickRequirement(existing, candidate)
+			if err != nil {
+				return nil, err
+			}
+			if chosen == existing {
+				continue
+			}
+
+			g.byKey[key] = chosen
+			if idx := slices.Index(next, existing); idx >= 0 {
+				next[idx] = chosen
+			} else {
+				next = append(next, chosen)
+			}
+		}
+	}
+
+	return next, nil
+}
+
+// replaced returns the keys of the resolved transitive requirements with dependencies of their own that were
+// replaced by another requirement. Their dependencies were added to the graph nevertheless.
+func (g *dependencyGraph) replaced(resolved []*resolvedDependency) map[string]bool {
+	keys := make(map[string]bool)
+	for _, r := range resolved {
+		if len(r.pending.via) > 0 && len(r.nested) > 0 && g.byKey[dependencyKey(&r.dep)] != r.pending {
+			keys[r.pending.key] = true
+		}
+	}
+	return keys
+}
+
+// chosen drops the transitive dependencies superseded by another requirement.
+func (g *dependencyGraph) chosen(resolved []*resolvedDependency) []*resolvedDependency {
+	result := make([]*resolvedDependency, 0, len(resolved))
+	for _, r := range resolved {
+		if len(r.pending.via) == 0 || g.byKey[dependencyKey(&r.dep)] == r.pending {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// pickRequirement resolves a version conflict. A direct dependency always wins. Of two semantic versions of
+// revision the highest wins, a revision matching a version constraint wins over the constraint, and two version
+// constraints are combined into one matching both. Requirements that can't be compared are reported as an error.
+func pickRequirement(existing, candidate *pendingDependency) (*pendingDependency, error) {
+	if existing.dep.Branch == candidate.dep.Branch && existing.dep.Revision == candidate.dep.Revision &&
+		existing.dep.Version == candidate.dep.Version {
+		return existing, nil
+	}
+
+	if len(existing.via) == 0 {
+		logger.Warn("%s requires %s at %s, using %s from protodep.toml",
+			strings.Join(candidate.via, " -> "), candidate.dep.DisplayName(), candidate.dep.Requirement(), existing.dep.Requirement())
+		return existing, nil
+	}
+
+	conflict := fmt.Errorf("conflicting requirements for %s: %s via %s and %s via %s", candidate.dep.DisplayName(),
+		existing.dep.Requirement(), strings.Join(existing.via, " -> "),
+		candidate.dep.Requirement(), strings.Join(candidate.via, " -> "))
+
+	if existing.dep.Version != "" && candidate.dep.Version != "" {
+		combined := *candidate
+		combined.dep.Version = intersectVersions(existing.dep.Version, candidate.dep.Version)
+		combined.key = candidate.key + " & " + existing.dep.Version
+		if _, err := combined.dep.VersionConstraint(); err != nil {
+			return nil, fmt.Errorf("%w: %w", conflict, err)
+		}
+		logger.Info("%s: using version %s required by %s and %s required by %s", candidate.dep.DisplayName(),
+			existing.dep.Version, strings.Join(existing.via, " -> "), candidate.dep.Version, strings.Join(candidate.via, " -> "))
+		return &combined, nil
+	}
+
+	if existing.dep.Version != "" || candidate.dep.Version != "" {
+		revision, constraint := existing, candidate
+		if existing.dep.Version != "" {
+			revision, constraint = candidate, existing
+		}
+		version, err := semver.NewVersion(revision.dep.Revision)
+		if err != nil {
+			return nil, conflict
+		}
+		c, err := constraint.dep.VersionConstraint()
+		if err != nil || !c.Check(version) {
+			return nil, conflict
+		}
+		logger.Info("%s: using %s required by %s, it matches version %s required by %s", candidate.dep.DisplayName(),
+			revision.dep.Revision, strings.Join(revision.via, " -> "), constraint.dep.Version, strings.Join(constraint.via, " -> "))
+		return revision, nil
+	}
+
+	existingVersion, existingErr := semver.NewVersion(existing.dep.Revision)
+	candidateVersion, candidateErr := semver.NewVersion(candidate.dep.Revision)
+	if existingErr != nil || candidateErr != nil {
+		return nil, conflict
+	}
+
+	chosen, other := existing, candidate
+	if candidateVersion.GreaterThan(existingVersion) {
+		chosen, other = candidate, existing
+	}
+	logger.Info("%s: using %s required by %s over %s required by %s", candidate.dep.DisplayName(),
+		chosen.dep.Revision, strings.Join(chosen.via, " -> "), other.dep.Revision, strings.Join(other.via, " -> "))
+
+	return chosen, nil
+}
+
+// intersectVersions returns a version constraint matching the versions both constraints match. Since || has
+// the lowest precedence, every alternative of a is combined with every alternative of b.
+func intersectVersions(a, b string) string {
+	var alternatives []string
+	for _, x := range strings.Split(a, "||") {
+		for _, y := range strings.Split(b, "||") {
+			alternatives = append(alternatives, strings.TrimSpace(x)+", "+strings.TrimSpace(y))
+		}
+	}
+	return strings.Join(alternatives, " || ")
+}
+
+// readNestedDependencies returns the dependencies of protodep.toml at the root of the repository, if any.
+func readNestedDependencies(opened *repository.OpenedRepository) ([]config.ProtoDepDependency, error) {
+	content, err := opened.ReadFile(config.FileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nested, err := config.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("nested %s: %w", config.FileName, err)
+	}
+
+	return nested.Dependencies, nil
+}
+
+// isLocalURL reports whether the url of a dependency is a local repository.
+func isLocalURL(raw string) bool {
+	u, err := config.ParseRepositoryURL(raw)
+	return err == nil && u.IsLocal()
+}
+
+func dependencyKey(dep *config.ProtoDepDependency) string {
+	return dep.Target + "|" + dep.Path
+}
@@ -0,0 +1,170 @@
+package resolver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// Update resolves the named dependencies again, ignoring their pins in protodep.lock, together with the transitive
+// dependencies they pull in. A dependency is named by its name, target or local folder, and without names every
+// dependency is updated. All other dependencies keep their locked commits, and local folders keep their vendored
+// files. Only the vendored files that changed are written or removed, the rest of proto_outdir is left as is.
+// The changes are made to a copy of proto_outdir, swapped in the same way as by Resolve.
+func (s *Resolver) Update(ctx context.Context, names []string) error {
+	dep := config.NewDependency(s.conf.TargetDir)
+	protodep, err := dep.Load()
+	if err != nil {
+		return err
+	}
+
+	lock, err := dep.LoadLock()
+	if err != nil {
+		return err
+	}
+
+	var targets []string
+	for _, name := range names {
+		found := false
+		for i := range protodep.Dependencies {
+			if protodep.Dependencies[i].Is(name) {
+				found = true
+				targets = append(targets, protodep.Dependencies[i].Target)
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not a dependency of %s", name, config.FileName)
+		}
+	}
+
+	selected := func(p *pendingDependency) bool {
+		if len(names) == 0 {
+			return true
+		}
+		if len(p.via) == 0 {
+			return slices.ContainsFunc(names, p.dep.Is)
+		}
+		// A transitive dependency follows the dependency that pulled it in.
+		return slices.Contains(targets, p.targets[0])
+	}
+
+	resolved, newLock, err := s.resolveAll(ctx, protodep, s.protodepDir(), lock, selected)
+	if err != nil {
+		return err
+	}
+
+	var files []resolvedFile
+	for i, r := range resolved {
+		old := lock.Find(&r.dep)
+
+		if !selected(r.pending) {
+			if r.dep.LocalFolder != "" && old != nil {
+				newLock.Dependencies[i] = *old
+				continue
+			}
+			files = append(files, r.files...)
+			continue
+		}
+
+		switch {
+		case old == nil:
+			logger.Info("%s: added at %s", r.dep.DisplayName(), lockedAt(&r.locked))
+		case old.Commit != r.locked.Commit:
+			logger.Info("%s: updated from %s to %s", r.dep.DisplayName(), lockedAt(old), lockedAt(&r.locked))
+		default:
+			logger.Info("%s is up to date", r.dep.DisplayName())
+		}
+		files = append(files, r.files...)
+	}
+
+	outdir := filepath.Join(s.conf.OutputDir, protodep.ProtoOutdir)
+	if err := stageOutdir(ctx, outdir, func(staging string) error {
+		if err := copyDir(ctx, outdir, staging); err != nil {
+			return err
+		}
+		return updateOutdir(ctx, staging, lock, newLock, files)
+	}); err != nil {
+		return err
+	}
+
+	return dep.SaveLock(newLock)
+}
+
+// updateOutdir writes the files whose content differs from the previous lock or that are missing on disk,
+// and removes the files that are no longer locked.
+func updateOutdir(ctx context.Context, outdir string, oldLock, newLock *config.ProtoDepLock, files []resolvedFile) error {
+	previous := make(map[string]string)
+	for _, d := range oldLock.Dependencies {
+		for _, f := range d.Files {
+			previous[f.Path] = f.SHA256
+		}
+	}
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(outdir, f.dest)
+		sum := sha256.Sum256(f.content)
+		if previous[filepath.ToSlash(f.dest)] == hex.EncodeToString(sum[:]) {
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+		}
+		if err := writeFileWithDirectory(path, f.content, 0o644); err != nil { //nolint:gomnd
+			return err
+		}
+	}
+
+	current := make(map[string]bool)
+	for _, d := range newLock.Dependencies {
+		for _, f := range d.Files {
+			current[f.Path] = true
+		}
+	}
+
+	for path := range previous {
+		if current[path] {
+			continue
+		}
+		if err := removeFile(outdir, filepath.FromSlash(path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeFile removes a file of dir and the parent directories it leaves empty.
+func removeFile(dir, rel string) error {
+	path := filepath.Join(dir, rel)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+
+	for parent := filepath.Dir(path); parent != dir && parent != "."; parent = filepath.Dir(parent) {
+		if err := os.Remove(parent); err != nil {
+			// Not empty or already gone.
+			break
+		}
+	}
+
+	return nil
+}
+
+func lockedAt(locked *config.LockedDependency) string {
+	if locked.Commit == "" {
+		return "local files"
+	}
+	if locked.Ref != "" {
+		return fmt.Sprintf("%s (%s)", locked.Commit, locked.Ref)
+	}
+	return locked.Commit
+}
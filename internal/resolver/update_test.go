@@ -0,0 +1,123 @@
+package resolver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/n-r-w/protodep/internal/config"
+)
+
+func TestUpdate(t *testing.T) {
+	foo := newFixtureRepo(t)
+	foo.commit(map[string]string{"foo.proto": "foo v1", "old.proto": "old"})
+	bar := newFixtureRepo(t)
+	barFirst := bar.commit(map[string]string{"bar.proto": "bar v1"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  name = "foo"
+  target = "example.com/org/foo"
+  branch = "master"
+  path = "foo"
+  protocol = "https"
+
+[[dependencies]]
+  target = "example.com/org/bar"
+  branch = "master"
+  path = "bar"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{
+		"example.com/org/foo": foo.URL(),
+		"example.com/org/bar": bar.URL(),
+	})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	outdir := filepath.Join(targetDir, "proto")
+	require.NoError(t, os.WriteFile(filepath.Join(outdir, "README.md"), []byte("not vendored"), 0o644))
+
+	wt, err := foo.repo.Worktree()
+	require.NoError(t, err)
+	_, err = wt.Remove("old.proto")
+	require.NoError(t, err)
+	fooLatest := foo.commit(map[string]string{"foo.proto": "foo v2"})
+	bar.commit(map[string]string{"bar.proto": "bar v2"})
+
+	require.Error(t, target.Update(context.Background(), []string{"example.com/org/unknown"}))
+	require.NoError(t, target.Update(context.Background(), []string{"foo"}))
+
+	content, err := os.ReadFile(filepath.Join(outdir, "foo/foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "foo v2", string(content))
+
+	require.NoFileExists(t, filepath.Join(outdir, "foo/old.proto"))
+
+	content, err = os.ReadFile(filepath.Join(outdir, "bar/bar.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "bar v1", string(content))
+
+	content, err = os.ReadFile(filepath.Join(outdir, "README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "not vendored", string(content))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 2)
+	require.Equal(t, "foo", lock.Dependencies[0].Name)
+	require.Equal(t, fooLatest.String(), lock.Dependencies[0].Commit)
+	require.Equal(t, barFirst.String(), lock.Dependencies[1].Commit)
+}
+
+func TestUpdateKeepsOutdirOnError(t *testing.T) {
+	foo := newFixtureRepo(t)
+	fooFirst := foo.commit(map[string]string{"foo.proto": "foo v1"})
+
+	targetDir := t.TempDir()
+	writeProtodepToml(t, targetDir, `
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example.com/org/foo"
+  branch = "master"
+  protocol = "https"
+`)
+
+	conf := Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: targetDir,
+	}
+	target := newFixtureResolver(t, &conf, map[string]string{"example.com/org/foo": foo.URL()})
+
+	require.NoError(t, target.Resolve(context.Background(), false))
+
+	// A directory that isn't vendored is in the way of a new file.
+	outdir := filepath.Join(targetDir, "proto")
+	require.NoError(t, os.MkdirAll(filepath.Join(outdir, "new.proto", "keep"), 0o750))
+	foo.commit(map[string]string{"foo.proto": "foo v2", "new.proto": "new"})
+
+	require.Error(t, target.Update(context.Background(), nil))
+
+	content, err := os.ReadFile(filepath.Join(outdir, "foo.proto"))
+	require.NoError(t, err)
+	require.Equal(t, "foo v1", string(content))
+	require.DirExists(t, filepath.Join(outdir, "new.proto", "keep"))
+
+	lock, err := config.NewDependency(targetDir).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, fooFirst.String(), lock.Dependencies[0].Commit)
+}
@@ -0,0 +1,199 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/n-r-w/protodep/internal/config"
+	"github.com/n-r-w/protodep/internal/logger"
+)
+
+// ErrOutOfDate is returned by Verify when proto_outdir or protodep.lock differ from the resolved dependencies.
+var ErrOutOfDate = errors.New("vendored proto files are out of date")
+
+// Verify resolves the dependencies into memory and compares them with proto_outdir and protodep.lock.
+// Nothing in the workspace is modified.
+func (s *Resolver) Verify(ctx context.Context) error {
+	dep := config.NewDependency(s.conf.TargetDir)
+	protodep, err := dep.Load()
+	if err != nil {
+		return err
+	}
+
+	lock, err := dep.LoadLock()
+	if err != nil {
+		return err
+	}
+
+	resolved, newLock, err := s.resolveAll(ctx, protodep, s.protodepDir(), lock, s.updateAll)
+	if err != nil {
+		return err
+	}
+
+	outdir := filepath.Join(s.conf.OutputDir, protodep.ProtoOutdir)
+	report, err := diffOutdir(outdir, resolved)
+	if err != nil {
+		return err
+	}
+	report = append(report, diffLock(lock, newLock)...)
+
+	if len(report) > 0 {
+		return fmt.Errorf("%w:\n%s", ErrOutOfDate, strings.Join(report, "\n"))
+	}
+
+	logger.Info("%s is up to date", protodep.ProtoOutdir)
+
+	return nil
+}
+
+type fileDrift struct {
+	kind string
+	path string
+}
+
+// diffOutdir compares the files of proto_outdir with the resolved ones.
+func diffOutdir(outdir string, resolved []*resolvedDependency) ([]string, error) {
+	expected := make(map[string][]byte)
+	for _, r := range resolved {
+		for _, f := range r.files {
+			expected[filepath.ToSlash(f.dest)] = f.content
+		}
+	}
+
+	actual := make(map[string]struct{})
+	var drift []fileDrift
+
+	err := filepath.WalkDir(outdir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == outdir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(outdir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		actual[rel] = struct{}{}
+
+		want, ok := expected[rel]
+		if !ok {
+			drift = append(drift, fileDrift{kind: "unexpected", path: rel})
+			return nil
+		}
+
+		content, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(content, want) {
+			drift = append(drift, fileDrift{kind: "modified", path: rel})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for rel := range expected {
+		if _, ok := actual[rel]; !ok {
+			drift = append(drift, fileDrift{kind: "missing", path: rel})
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].path < drift[j].path
+	})
+
+	report := make([]string, 0, len(drift))
+	for _, d := range drift {
+		report = append(report, fmt.Sprintf("%-11s %s", d.kind+":", d.path))
+	}
+
+	return report, nil
+}
+
+// diffLock compares protodep.lock with the lock produced by the resolution.
+func diffLock(lock, newLock *config.ProtoDepLock) []string {
+	var report []string
+	drift := func(format string, a ...any) {
+		report = append(report, fmt.Sprintf("%-11s %s", "lock:", fmt.Sprintf(format, a...)))
+	}
+
+	for i := range newLock.Dependencies {
+		entry := &newLock.Dependencies[i]
+
+		old := lock.Find(entryDependency(entry))
+		switch {
+		case old == nil:
+			drift("%s is not locked", entryDependency(entry).DisplayName())
+		default:
+			if diffs := diffLockedDependency(old, entry); len(diffs) > 0 {
+				drift("%s: %s", entryDependency(entry).DisplayName(), strings.Join(diffs, ", "))
+			}
+		}
+	}
+
+	for i := range lock.Dependencies {
+		entry := &lock.Dependencies[i]
+		if newLock.Find(entryDependency(entry)) == nil {
+			drift("%s is not in protodep.toml", entryDependency(entry).DisplayName())
+		}
+	}
+
+	return report
+}
+
+// diffLockedDependency describes the fields of a lock entry differing from the resolved one.
+func diffLockedDependency(old, entry *config.LockedDependency) []string {
+	var diffs []string
+	field := func(name, locked, resolved string) {
+		if locked != resolved {
+			diffs = append(diffs, fmt.Sprintf("%s %s locked, %s resolved", name, orNone(locked), orNone(resolved)))
+		}
+	}
+
+	field("commit", old.Commit, entry.Commit)
+	field("ref", old.Ref, entry.Ref)
+	field("url", old.URL, entry.URL)
+	field("branch", old.Branch, entry.Branch)
+	field("revision", old.Revision, entry.Revision)
+	field("version", old.Version, entry.Version)
+	field("name", old.Name, entry.Name)
+	field("via", strings.Join(old.Via, " -> "), strings.Join(entry.Via, " -> "))
+	if !reflect.DeepEqual(old.Files, entry.Files) {
+		diffs = append(diffs, "files differ")
+	}
+
+	return diffs
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+func entryDependency(entry *config.LockedDependency) *config.ProtoDepDependency {
+	return &config.ProtoDepDependency{
+		Name:        entry.Name,
+		Target:      entry.Target,
+		LocalFolder: entry.LocalFolder,
+		Path:        entry.Path,
+	}
+}